@@ -1,23 +1,48 @@
 package apictx
 
 import (
-	"encoding/json"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"reflect"
-	"strconv"
+	"runtime/debug"
+	"slices"
 	"strings"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
 )
 
+// MaxMultipartMemory is the number of bytes of a multipart/form-data body
+// kept in memory while binding, the remainder is stored in temporary files.
+var MaxMultipartMemory int64 = 32 << 20
+
 type User interface {
 	ID() string
 }
 
+// Binder is implemented by bind targets that read the request themselves,
+// e.g. for custom wire formats. Bind delegates decoding to them entirely
+// and only validates the result.
+type Binder interface {
+	Bind(r *http.Request) error
+}
+
+// AfterBinder is implemented by bind targets that normalize or derive
+// fields once the request is decoded. AfterBind runs before validation.
+type AfterBinder interface {
+	AfterBind(ctx *Context) error
+}
+
 type HandlerFunc func(http.ResponseWriter, *http.Request)
 type ContextFunc func(ctx *Context) error
 
@@ -26,44 +51,11 @@ type ApiResponse struct {
 	Response interface{}
 }
 
-type ApiErrorResponse struct {
-	Code    interface{} `json:"code"`
-	Message string      `json:"message"`
-	Cause   error       `json:"-"`
-}
-
-// HttpError used to handle generic error for the context
-type HttpError struct {
-	err        error
-	msg        string
-	statusCode int
-}
-
-func NewHttpError(msg string, err error, statsuCode ...int) *HttpError {
-	statusCode := http.StatusBadRequest
-
-	if len(statsuCode) == 1 && statsuCode[0] >= 200 && statsuCode[0] <= 520 {
-		statusCode = statsuCode[0]
-	}
-	return &HttpError{err: err, msg: msg, statusCode: statusCode}
-}
-
-func (e HttpError) Error() string {
-	return e.msg
-}
-
-func (e HttpError) Cause() error {
-	return e.err
-}
-
-func (e HttpError) Status() int {
-	return e.statusCode
-}
-
 type Context struct {
 	CurrentUser User
 	writer      http.ResponseWriter
 	request     *http.Request
+	rawBody     []byte
 }
 
 func NewContext(w http.ResponseWriter, r *http.Request, user User) Context {
@@ -82,95 +74,416 @@ func (c *Context) Writer() http.ResponseWriter {
 	return c.writer
 }
 
-func (c *Context) Bind(data interface{}) *HttpError {
-	err := c.BindWithoutValidation(data)
+// RawBody reads and caches the request body, so it can be inspected, e.g.
+// for signature verification, and still be bound afterwards. The body is
+// limited by DefaultBindOptions.MaxBodyBytes.
+func (c *Context) RawBody() ([]byte, error) {
+	if c.rawBody == nil {
+		c.limitBody(DefaultBindOptions)
+		b, err := io.ReadAll(c.request.Body)
+		if err != nil {
+			if httpErr := bodyTooLarge(err); httpErr != nil {
+				return nil, httpErr
+			}
+			return nil, NewHttpError("failed to read inputs", err, http.StatusBadRequest)
+		}
+		c.request.Body.Close()
+		c.rawBody = b
+	}
+	c.resetBody()
+	return c.rawBody, nil
+}
+
+// resetBody rewinds the request body to the bytes cached by RawBody.
+func (c *Context) resetBody() {
+	if c.rawBody != nil {
+		c.request.Body = io.NopCloser(bytes.NewReader(c.rawBody))
+	}
+}
+
+func (c *Context) Bind(data interface{}, opts ...BindOption) *HttpError {
+	err := c.BindWithoutValidation(data, opts...)
 	if err != nil {
+		var httpErr *HttpError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
 		return NewHttpError("failed to read inputs", err, http.StatusBadRequest)
 	}
-	// Validate the data
-	v := validator.New()
-	err = v.Struct(data)
+	return c.Validate(data, opts...)
+}
+
+// Validate validates data like Bind does, for structs that are built or
+// changed by the handler after binding.
+func (c *Context) Validate(data interface{}, opts ...BindOption) *HttpError {
+	return validateStruct(c.request.Context(), data, c.request.Header.Get("Accept-Language"), newBindOptions(opts))
+}
+
+// BindQuery binds and validates only the query parameters.
+func (c *Context) BindQuery(data interface{}, opts ...BindOption) *HttpError {
+	return c.Bind(data, append(opts, Precedence(SourceQuery))...)
+}
+
+// BindPath binds and validates only the route pattern wildcards.
+func (c *Context) BindPath(data interface{}, opts ...BindOption) *HttpError {
+	return c.Bind(data, append(opts, Precedence(SourcePath))...)
+}
+
+// BindHeaders binds and validates only the request headers.
+func (c *Context) BindHeaders(data interface{}, opts ...BindOption) *HttpError {
+	return c.Bind(data, append(opts, Precedence(SourceHeader))...)
+}
+
+// BindCookies binds and validates only the request cookies.
+func (c *Context) BindCookies(data interface{}, opts ...BindOption) *HttpError {
+	return c.Bind(data, append(opts, Precedence(SourceCookie))...)
+}
+
+// BindBody binds and validates only the request body.
+func (c *Context) BindBody(data interface{}, opts ...BindOption) *HttpError {
+	return c.Bind(data, append(opts, Precedence(SourceBody))...)
+}
+
+// Bind binds the request into a new value of type T and validates it.
+//
+//	req, err := apictx.Bind[CreateUserRequest](ctx)
+func Bind[T any](c *Context, opts ...BindOption) (T, *HttpError) {
+	var data T
+	err := c.Bind(&data, opts...)
+	return data, err
+}
+
+func (c *Context) BindWithoutValidation(data interface{}, opts ...BindOption) error {
+	if b, ok := data.(Binder); ok {
+		return b.Bind(c.request)
+	}
+
+	o := newBindOptions(opts)
+
+	if reflect.ValueOf(data).Elem().Kind() != reflect.Struct {
+		// slices, maps and scalars can only come from the body as a whole,
+		// so BindQuery and the like leave them as they are
+		if slices.Contains(o.precedenceFor(data), SourceBody) {
+			err := c.bindBody(data, o)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		err := c.bindStruct(data, o)
+		if err != nil {
+			return err
+		}
+	}
+
+	if ab, ok := data.(AfterBinder); ok {
+		return ab.AfterBind(c)
+	}
+	return nil
+}
+
+// bindStruct binds the fields of the struct data points to from every
+// request source.
+func (c *Context) bindStruct(data interface{}, o BindOptions) error {
+	err := checkModifiers(reflect.TypeOf(data))
 	if err != nil {
-		var errMsgs []string
-		for _, e := range err.(validator.ValidationErrors) {
-			errMsgs = append(errMsgs, fmt.Sprintf("validation failed for %s", e.Field()))
+		return defaultsError(err)
+	}
+
+	// Apply defaults for the fields left unset by the request
+	err = applyDefaults(reflect.ValueOf(data).Elem())
+	if err != nil {
+		return defaultsError(err)
+	}
+
+	// Bind the request sources from the lowest to the highest precedence,
+	// so that values from the latter overwrite the former
+	precedence := o.precedenceFor(data)
+	for i := len(precedence) - 1; i >= 0; i-- {
+		err = c.bindSource(data, precedence[i], o)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Normalize the bound strings
+	err = applyModifiers(reflect.ValueOf(data))
+	if err != nil {
+		return defaultsError(err) // a modifier in a struct behind an interface
+	}
+	return nil
+}
+
+func (c *Context) bindSource(data interface{}, source BindSource, o BindOptions) error {
+	switch source {
+	case SourceQuery:
+		return bindQuery(data, c.request.URL.Query(), o)
+	case SourcePath:
+		return c.BindPathParams(data)
+	case SourceHeader:
+		return c.BindHeaderParams(data)
+	case SourceCookie:
+		return c.BindCookieParams(data)
+	case SourceBody:
+		return c.bindBody(data, o)
+	}
+	return fmt.Errorf("unknown bind source %q", source)
+}
+
+// bindBody decodes the request body with the binder registered for its
+// Content-Type. Bodies of other types are ignored.
+func (c *Context) bindBody(data interface{}, o BindOptions) error {
+	binder, ok := lookupBinder(c.request.Header.Get("Content-Type"))
+	if !ok {
+		return nil
+	}
+
+	c.resetBody()
+	c.limitBody(o)
+	if httpErr := c.decompressBody(o); httpErr != nil {
+		return httpErr
+	}
+	err := binder(c, data, o)
+	if err != nil {
+		if httpErr := bodyTooLarge(err); httpErr != nil {
+			return httpErr
 		}
+		return err
+	}
+
+	return nil
+}
+
+// limitBody caps the number of bytes read from the request body.
+func (c *Context) limitBody(o BindOptions) {
+	if o.MaxBodyBytes > 0 {
+		c.request.Body = http.MaxBytesReader(c.writer, c.request.Body, o.MaxBodyBytes)
+	}
+}
+
+// decompressBody replaces a gzip or deflate encoded request body with its
+// decompressed content, capped at o.MaxDecompressedBytes.
+func (c *Context) decompressBody(o BindOptions) *HttpError {
+	var (
+		zr  io.ReadCloser
+		err error
+	)
+	switch encoding := strings.ToLower(c.request.Header.Get("Content-Encoding")); encoding {
+	case "", "identity":
+		return nil
+	case "gzip", "x-gzip":
+		zr, err = gzip.NewReader(c.request.Body)
+	case "deflate":
+		zr, err = zlib.NewReader(c.request.Body)
+	default:
 		return NewHttpError(
-			fmt.Sprintf("validation error(s): %s", strings.Join(errMsgs, ", ")),
+			fmt.Sprintf("unsupported content encoding %q", encoding),
 			nil,
-			http.StatusBadRequest,
+			http.StatusUnsupportedMediaType,
 		)
 	}
+	if err != nil {
+		if httpErr := bodyTooLarge(err); httpErr != nil {
+			return httpErr
+		}
+		return NewHttpError("failed to read inputs", fmt.Errorf("failed to decompress body: %w", err), http.StatusBadRequest)
+	}
+
+	body := io.ReadCloser(decompressedBody{zr, c.request.Body})
+	if o.MaxDecompressedBytes > 0 {
+		body = http.MaxBytesReader(c.writer, body, o.MaxDecompressedBytes)
+	}
+	c.request.Body = body
 	return nil
 }
 
-func (c *Context) BindWithoutValidation(data interface{}) error {
-	// Bind query parameters
-	queryParams := c.request.URL.Query()
-	err := c.BindQueryParams(data, queryParams)
+// decompressedBody reads from a decompressor and closes it together with
+// the underlying request body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	b.ReadCloser.Close()
+	return b.body.Close()
+}
+
+// errEmptyBody returns the 400 error of a body decoder finding no data.
+func errEmptyBody(err error) *HttpError {
+	return NewHttpError("empty request body", err, http.StatusBadRequest)
+}
+
+// bodyTooLarge returns a 413 error if err was caused by a body exceeding
+// the limit set by limitBody.
+func bodyTooLarge(err error) *HttpError {
+	var maxErr *http.MaxBytesError
+	if !errors.As(err, &maxErr) {
+		return nil
+	}
+	return NewHttpError(
+		fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit),
+		err,
+		http.StatusRequestEntityTooLarge,
+	)
+}
+
+func (c *Context) BindQueryParams(data interface{}, params map[string][]string) error {
+	return bindQuery(data, params, DefaultBindOptions)
+}
+
+func bindQuery(data interface{}, params map[string][]string, o BindOptions) error {
+	if o.CaseInsensitiveQuery {
+		return bindValues(data, "query", foldSource{mapSource(params)})
+	}
+	return bindValues(data, "query", mapSource(params))
+}
+
+// BindPathParams binds the wildcards of the matched route pattern, such as
+// {id} in /users/{id}, to the fields tagged with `path`.
+func (c *Context) BindPathParams(data interface{}) error {
+	return bindValues(data, "path", pathSource{c.request})
+}
+
+// BindFormBody binds the urlencoded body of POST, PUT and PATCH requests
+// to the fields tagged with `form`.
+func (c *Context) BindFormBody(data interface{}) error {
+	err := c.request.ParseForm()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to parse form body: %w", err)
 	}
+	return bindValues(data, "form", mapSource(c.request.PostForm))
+}
 
-	// Bind request body
-	contentType := c.request.Header.Get("Content-Type")
-	if contentType == "application/json" {
-		err = c.BindJSONBody(data, c.request.Body)
-	} else {
-		// Handle other content types like form data
+// BindMultipartForm binds the text fields of a multipart/form-data body to
+// the fields tagged with `form`, and uploaded files to `form` tagged fields
+// of type *multipart.FileHeader or []*multipart.FileHeader.
+func (c *Context) BindMultipartForm(data interface{}) error {
+	err := c.request.ParseMultipartForm(MaxMultipartMemory)
+	if err != nil {
+		return fmt.Errorf("failed to parse multipart form: %w", err)
 	}
+	err = bindValues(data, "form", mapSource(c.request.MultipartForm.Value))
 	if err != nil {
 		return err
 	}
+	return bindFiles(data, "form", c.request.MultipartForm.File)
+}
+
+// BindHeaderParams binds the request headers to the fields tagged with
+// `header`. Header names are matched case-insensitively.
+func (c *Context) BindHeaderParams(data interface{}) error {
+	return bindValues(data, "header", c.request.Header)
+}
+
+// BindCookieParams binds the request cookies to the fields tagged with
+// `cookie`.
+func (c *Context) BindCookieParams(data interface{}) error {
+	return bindValues(data, "cookie", cookieSource{c.request})
+}
 
+func (c *Context) BindJSONBody(data interface{}, body io.Reader) error {
+	return decodeJSON(data, body, DefaultBindOptions)
+}
+
+func decodeJSON(data interface{}, body io.Reader, o BindOptions) error {
+	dec := jsonCodec.NewDecoder(body)
+	if o.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(data)
+	if err != nil {
+		if err == io.EOF {
+			return errEmptyBody(err)
+		}
+		return fmt.Errorf("failed to decode JSON body: %w", err)
+	}
 	return nil
 }
 
-func (c *Context) BindQueryParams(data interface{}, params map[string][]string) error {
-	val := reflect.ValueOf(data).Elem()
-	typ := val.Type()
-
-	for i := 0; i < val.NumField(); i++ {
-		field := val.Field(i)
-		tag := typ.Field(i).Tag.Get("query")
-		if tag != "" {
-			paramValues, ok := params[tag]
-			if ok && len(paramValues) > 0 {
-				paramValue := paramValues[0] // Use the first value
-				switch field.Kind() {
-				case reflect.String:
-					field.SetString(paramValue)
-				case reflect.Int:
-					intValue, err := strconv.Atoi(paramValue)
-					if err != nil {
-						return fmt.Errorf("failed to convert parameter %s to int: %s", tag, err)
-					}
-					field.SetInt(int64(intValue))
-					// Add cases for other types as needed
-				}
-			}
+func (c *Context) BindXMLBody(data interface{}, body io.Reader) error {
+	err := xml.NewDecoder(body).Decode(data)
+	if err != nil {
+		if err == io.EOF {
+			return errEmptyBody(err)
 		}
+		return fmt.Errorf("failed to decode XML body: %w", err)
 	}
+	return nil
+}
 
+// BindYAMLBody decodes a YAML body into data. The YAML document is converted
+// to JSON first, so data is decoded using its `json` tags.
+func (c *Context) BindYAMLBody(data interface{}, body io.Reader) error {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read YAML body: %w", err)
+	}
+	err = yaml.Unmarshal(b, data)
+	if err != nil {
+		return fmt.Errorf("failed to decode YAML body: %w", err)
+	}
 	return nil
 }
 
-func (c *Context) BindJSONBody(data interface{}, body io.Reader) error {
-	err := json.NewDecoder(body).Decode(data)
+// BindMsgPackBody decodes a MessagePack body into data using its `json` tags.
+func (c *Context) BindMsgPackBody(data interface{}, body io.Reader) error {
+	dec := msgpack.NewDecoder(body)
+	dec.SetCustomStructTag("json")
+	err := dec.Decode(data)
 	if err != nil {
-		return fmt.Errorf("failed to decode JSON body: %s", err)
+		if err == io.EOF {
+			return errEmptyBody(err)
+		}
+		return fmt.Errorf("failed to decode MessagePack body: %w", err)
 	}
 	return nil
 }
 
-func (c *Context) JSON(code int, data interface{}) {
-	statusCode := code
-	if statusCode == 0 {
-		statusCode = http.StatusOK
+// BindCBORBody decodes a CBOR body into data using its `cbor` tags, falling
+// back to its `json` tags.
+func (c *Context) BindCBORBody(data interface{}, body io.Reader) error {
+	err := cbor.NewDecoder(body).Decode(data)
+	if err != nil {
+		if err == io.EOF {
+			return errEmptyBody(err)
+		}
+		return fmt.Errorf("failed to decode CBOR body: %w", err)
 	}
-	c.writer.Header().Set("Content-Type", "application/json;charset=utf-8")
-	c.writer.WriteHeader(statusCode)
-	json.NewEncoder(c.writer).Encode(data)
+	return nil
+}
+
+// BindProto decodes an application/x-protobuf body into msg. JSON bodies are
+// decoded using the protobuf JSON mapping.
+func (c *Context) BindProto(msg proto.Message) *HttpError {
+	c.limitBody(DefaultBindOptions)
+	if httpErr := c.decompressBody(DefaultBindOptions); httpErr != nil {
+		return httpErr
+	}
+	body, err := io.ReadAll(c.request.Body)
+	if err != nil {
+		if httpErr := bodyTooLarge(err); httpErr != nil {
+			return httpErr
+		}
+		return NewHttpError("failed to read inputs", err, http.StatusBadRequest)
+	}
+
+	switch contentType := mediaType(c.request.Header.Get("Content-Type")); contentType {
+	case "application/x-protobuf", "application/protobuf":
+		err = proto.Unmarshal(body, msg)
+	case "application/json":
+		err = protojson.Unmarshal(body, msg)
+	default:
+		return NewHttpError(
+			fmt.Sprintf("unsupported content type %q", contentType),
+			nil,
+			http.StatusUnsupportedMediaType,
+		)
+	}
+	if err != nil {
+		return NewHttpError("failed to read inputs", fmt.Errorf("failed to decode protobuf body: %s", err), http.StatusBadRequest)
+	}
+	return nil
 }
 
 func Handler(c ContextFunc) http.HandlerFunc {
@@ -178,38 +491,69 @@ func Handler(c ContextFunc) http.HandlerFunc {
 
 		// parse uer details or return 403
 
+		r = withRequestID(w, r)
 		ctx := Context{
 			writer:  w,
 			request: r,
 		}
+		defer recoverPanic(&ctx)
 
 		err := c(&ctx)
 		if err != nil {
-			HandleError(w, r, err)
+			ctx.handleError(err)
 			return
 		}
 	}
 }
 
-func HandleError(w http.ResponseWriter, r *http.Request, err error, overRideStatusCode ...int) {
-	var errRes ApiErrorResponse
-	statusCode := http.StatusInternalServerError
+// OnPanic sets fn to be called with the context of the request, the
+// recovered value and the stack trace when a handler wrapped by Handler
+// panics, e.g. to alert on it. The panic is logged and answered with 500
+// Internal Server Error either way. It is not safe for concurrent use and
+// should be called during initialization.
+func OnPanic(fn func(ctx *Context, recovered interface{}, stack []byte)) {
+	panicHook = fn
+}
 
-	if len(overRideStatusCode) == 1 {
-		statusCode = overRideStatusCode[0]
-	}
+var panicHook func(ctx *Context, recovered interface{}, stack []byte)
 
-	var httpErr *HttpError
-	if errors.As(err, &httpErr) {
-		slog.Debug("api error: "+httpErr.Error(), "error", httpErr.Cause(), r.Method, r.URL)
-		statusCode = httpErr.Status()
-		errRes = ApiErrorResponse{0x6400, httpErr.Error(), httpErr.Cause()}
-	} else {
-		slog.Warn("internal error", "error", err, r.Method, r.URL)
-		errRes = ApiErrorResponse{0x0, "Internal error", nil}
+// recoverPanic answers a panicking handler with an internal error. The
+// http.ErrAbortHandler panic is passed on, as it aborts the response on
+// purpose.
+func recoverPanic(c *Context) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if recovered == http.ErrAbortHandler {
+		panic(recovered)
+	}
+	r := c.request
+	stack := debug.Stack()
+	slog.Error("panic in handler", "panic", recovered, "stack", string(stack), r.Method, r.URL, "request_id", RequestID(r))
+	if panicHook != nil {
+		panicHook(c, recovered, stack)
 	}
+	c.handleError(fmt.Errorf("panic: %v", recovered))
+}
+
+// ResultFunc is a handler returning its response instead of writing it.
+type ResultFunc func(ctx *Context) (ApiResponse, error)
 
-	w.Header().Set("Content-Type", "application/json;charset=utf-8")
-	w.WriteHeader(statusCode)
-	json.NewEncoder(w).Encode(errRes)
+// ResultHandler wraps fn like Handler. The returned ApiResponse is written
+// as JSON, with an empty body when Response is nil, and errors go through
+// HandleError, so a handler cannot write both.
+func ResultHandler(fn ResultFunc) http.HandlerFunc {
+	return Handler(func(ctx *Context) error {
+		res, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		if res.Response == nil {
+			ctx.Status(res.Code)
+			return nil
+		}
+		ctx.JSON(res.Code, res.Response)
+		return nil
+	})
 }
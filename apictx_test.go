@@ -0,0 +1,122 @@
+package apictx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func encodedRequest(t *testing.T, encoding string, body []byte) *http.Request {
+	t.Helper()
+	var buf bytes.Buffer
+	var zw io.WriteCloser
+	switch encoding {
+	case "gzip":
+		zw = gzip.NewWriter(&buf)
+	case "deflate":
+		zw = zlib.NewWriter(&buf)
+	default:
+		t.Fatalf("unknown encoding %s", encoding)
+	}
+	zw.Write(body)
+	zw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &buf)
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Encoding", encoding)
+	return r
+}
+
+func TestBindDecompressesBody(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			var got struct {
+				Name string `json:"name"`
+			}
+			err := newTestContext(encodedRequest(t, encoding, []byte(`{"name":"Ada"}`))).Bind(&got)
+			if err != nil || got.Name != "Ada" {
+				t.Fatalf("got %+v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestBindDecompressionBomb(t *testing.T) {
+	// 40 MiB of zeros compress to a few KiB
+	body := append([]byte(`{"name":"`), bytes.Repeat([]byte("0"), 40<<20)...)
+	body = append(body, `"}`...)
+	r := encodedRequest(t, "gzip", body)
+	if r.ContentLength > DefaultBindOptions.MaxBodyBytes {
+		t.Fatalf("compressed body of %d bytes is not small enough", r.ContentLength)
+	}
+
+	var got struct {
+		Name string `json:"name"`
+	}
+	err := newTestContext(r).Bind(&got)
+	if err == nil || err.Status() != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %v, want 413", err)
+	}
+}
+
+func TestBindStreamDecompressionBomb(t *testing.T) {
+	line := []byte(`{"name":"` + strings.Repeat("0", 1<<20) + `"}` + "\n")
+	r := encodedRequest(t, "gzip", bytes.Repeat(line, 40))
+
+	err := BindStream(newTestContext(r), func(item struct{ Name string }) error { return nil })
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) || httpErr.Status() != http.StatusRequestEntityTooLarge {
+		t.Fatalf("got %v, want 413", err)
+	}
+}
+
+func TestBindBodyLimits(t *testing.T) {
+	body := `{"name":"` + strings.Repeat("x", 100) + `"}`
+	tests := []struct {
+		name     string
+		encoding string
+		opts     []BindOption
+		want     int
+	}{
+		{"under the limit", "", []BindOption{MaxBodyBytes(1 << 10)}, 0},
+		{"over the limit", "", []BindOption{MaxBodyBytes(10)}, http.StatusRequestEntityTooLarge},
+		{"unsupported encoding", "br", nil, http.StatusUnsupportedMediaType},
+		{"corrupt gzip", "gzip", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			var got struct {
+				Name string `json:"name"`
+			}
+			err := newTestContext(r).Bind(&got, tt.opts...)
+			switch {
+			case tt.want == 0 && err != nil:
+				t.Fatalf("got %v", err)
+			case tt.want != 0 && (err == nil || err.Status() != tt.want):
+				t.Fatalf("got %v, want %d", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindEmptyBody(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", http.NoBody)
+	r.Header.Set("Content-Type", "application/json")
+	var got struct {
+		Name string `json:"name"`
+	}
+	err := newTestContext(r).Bind(&got)
+	if err == nil || err.Status() != http.StatusBadRequest || err.Error() != "empty request body" {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package apictx
+
+import (
+	"mime"
+	"strings"
+)
+
+// BinderFunc decodes the request body of ctx into data.
+type BinderFunc func(ctx *Context, data interface{}, opts BindOptions) error
+
+var binders = map[string]BinderFunc{}
+
+// RegisterBinder sets fn as the body decoder for requests with the given
+// Content-Type, replacing any decoder registered before. It is not safe for
+// concurrent use and should be called during initialization.
+func RegisterBinder(contentType string, fn BinderFunc) {
+	binders[strings.ToLower(contentType)] = fn
+}
+
+// lookupBinder returns the body decoder registered for the media type of
+// contentType, ignoring parameters such as charset. Structured syntax
+// suffixes fall back to their base format, so application/problem+json is
+// decoded as application/json unless it has a binder of its own.
+func lookupBinder(contentType string) (BinderFunc, bool) {
+	mt := mediaType(contentType)
+	if fn, ok := binders[mt]; ok {
+		return fn, true
+	}
+	if i := strings.LastIndexByte(mt, '+'); i >= 0 {
+		fn, ok := binders["application/"+mt[i+1:]]
+		return fn, ok
+	}
+	return nil, false
+}
+
+// mediaType returns the lower-cased type/subtype of a Content-Type header.
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
+func init() {
+	RegisterBinder("application/json", func(c *Context, data interface{}, o BindOptions) error {
+		return decodeJSON(data, c.request.Body, o)
+	})
+
+	xmlBinder := func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindXMLBody(data, c.request.Body)
+	}
+	RegisterBinder("application/xml", xmlBinder)
+	RegisterBinder("text/xml", xmlBinder)
+
+	yamlBinder := func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindYAMLBody(data, c.request.Body)
+	}
+	RegisterBinder("application/yaml", yamlBinder)
+	RegisterBinder("text/yaml", yamlBinder)
+
+	msgPackBinder := func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindMsgPackBody(data, c.request.Body)
+	}
+	RegisterBinder("application/msgpack", msgPackBinder)
+	RegisterBinder("application/x-msgpack", msgPackBinder)
+
+	RegisterBinder("application/cbor", func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindCBORBody(data, c.request.Body)
+	})
+	RegisterBinder("application/x-www-form-urlencoded", func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindFormBody(data)
+	})
+	RegisterBinder("multipart/form-data", func(c *Context, data interface{}, _ BindOptions) error {
+		return c.BindMultipartForm(data)
+	})
+}
@@ -0,0 +1,37 @@
+package apictx
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CacheFor lets clients and caches reuse the response for d, setting
+// Cache-Control max-age and Expires.
+func (c *Context) CacheFor(d time.Duration) {
+	c.cacheHeaders(fmt.Sprintf("max-age=%d", seconds(d)), d)
+}
+
+// StaleWhileRevalidate lets caches reuse the response for d, and for swr
+// longer while they fetch a fresh one in the background.
+func (c *Context) StaleWhileRevalidate(d, swr time.Duration) {
+	c.cacheHeaders(fmt.Sprintf("max-age=%d, stale-while-revalidate=%d", seconds(d), seconds(swr)), d)
+}
+
+// NoStore keeps the response out of every cache, for sensitive data.
+func (c *Context) NoStore() {
+	h := c.writer.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Del("Expires")
+}
+
+func (c *Context) cacheHeaders(cacheControl string, d time.Duration) {
+	h := c.writer.Header()
+	h.Set("Cache-Control", cacheControl)
+	h.Set("Expires", time.Now().Add(d).UTC().Format(http.TimeFormat))
+}
+
+// seconds returns d in whole seconds, zero for negative durations.
+func seconds(d time.Duration) int64 {
+	return max(int64(d/time.Second), 0)
+}
@@ -0,0 +1,51 @@
+package apictx
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONCodec encodes and decodes the JSON of requests and responses, so
+// encoding/json can be replaced by a faster implementation such as sonic
+// or jsoniter.
+type JSONCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	NewEncoder(w io.Writer) JSONEncoder
+	NewDecoder(r io.Reader) JSONDecoder
+}
+
+// JSONEncoder is the stream encoder of a JSONCodec.
+type JSONEncoder interface {
+	Encode(v interface{}) error
+	SetIndent(prefix, indent string)
+}
+
+// JSONDecoder is the stream decoder of a JSONCodec.
+type JSONDecoder interface {
+	Decode(v interface{}) error
+	DisallowUnknownFields()
+}
+
+// jsonCodec is the JSONCodec in use, set with SetJSONCodec.
+var jsonCodec JSONCodec = stdJSON{}
+
+// SetJSONCodec replaces encoding/json for binding and writing JSON. It is
+// not safe for concurrent use and should be called during initialization.
+func SetJSONCodec(codec JSONCodec) {
+	jsonCodec = codec
+}
+
+// stdJSON is the JSONCodec of encoding/json.
+type stdJSON struct{}
+
+func (stdJSON) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (stdJSON) NewEncoder(w io.Writer) JSONEncoder {
+	return json.NewEncoder(w)
+}
+
+func (stdJSON) NewDecoder(r io.Reader) JSONDecoder {
+	return json.NewDecoder(r)
+}
@@ -0,0 +1,186 @@
+package apictx
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestAcceptedEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"identity":              "",
+		"gzip":                  "gzip",
+		"gzip, br":              "br",
+		"br;q=0.5, gzip":        "gzip",
+		"gzip;q=0, br;q=0":      "",
+		"*":                     "br",
+		"*;q=0.5, gzip;q=1":     "gzip",
+		"GZIP":                  "gzip",
+		"br;q=bogus, gzip;q=.1": "gzip",
+	}
+	for header, want := range tests {
+		if got := acceptedEncoding(header); got != want {
+			t.Errorf("%q: got %q, want %q", header, got, want)
+		}
+	}
+}
+
+func serveCompressed(t *testing.T, acceptEncoding string, h http.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	Compress(h).ServeHTTP(w, r)
+	return w
+}
+
+func TestCompress(t *testing.T) {
+	body := strings.Repeat("hello world ", 500)
+	text := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, body)
+	}
+
+	for _, encoding := range []string{"gzip", "br"} {
+		t.Run(encoding, func(t *testing.T) {
+			w := serveCompressed(t, encoding, text)
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("got Content-Encoding %q", got)
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Error("missing Vary: Accept-Encoding")
+			}
+			var zr io.Reader
+			if encoding == "gzip" {
+				gr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				zr = gr
+			} else {
+				zr = brotli.NewReader(w.Body)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil || string(got) != body {
+				t.Fatalf("decoded %d bytes, %v", len(got), err)
+			}
+		})
+	}
+}
+
+func TestCompressSkips(t *testing.T) {
+	large := strings.Repeat("x", 4096)
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		handler        http.HandlerFunc
+	}{
+		{"not accepted", "", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, large)
+		}},
+		{"small body", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "small")
+		}},
+		{"compressed type", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			io.WriteString(w, large)
+		}},
+		{"encoded already", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "zstd")
+			io.WriteString(w, large)
+		}},
+		{"partial content", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-4095/10000")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, large)
+		}},
+		{"no content", "gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveCompressed(t, tt.acceptEncoding, tt.handler)
+			if got := w.Header().Get("Content-Encoding"); got == "gzip" || got == "br" {
+				t.Fatalf("got Content-Encoding %q", got)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	w := serveCompressed(t, "gzip", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		http.NewResponseController(w).Flush()
+		if !w.(*compressWriter).decided {
+			t.Error("flush did not start the response")
+		}
+	})
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("flushed response is not compressed")
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(gr)
+	if string(got) != "data: 1\n\n" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestCompressAttachmentRange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.txt")
+	body := strings.Repeat("hello world ", 1000)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	h := Compress(Handler(func(c *Context) error {
+		c.Attachment(path, "report.txt")
+		return nil
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if w.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("got Content-Encoding %q and ETag %q", w.Header().Get("Content-Encoding"), etag)
+	}
+
+	// resuming the encoded download must not yield unencoded bytes
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	r.Header.Set("Range", "bytes=100-")
+	r.Header.Set("If-Range", etag)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got status %d with Content-Encoding %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+
+	// without compression the strong tag still allows ranges
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	strong := w.Header().Get("ETag")
+	r.Header.Set("Range", "bytes=100-")
+	r.Header.Set("If-Range", strong)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != body[100:] {
+		t.Fatalf("got status %d for If-Range %s", w.Code, strong)
+	}
+}
@@ -0,0 +1,82 @@
+package apictx
+
+import (
+	"net/http"
+	"time"
+)
+
+// CookieOption changes a cookie set by SetCookie or removed by DeleteCookie.
+type CookieOption func(*http.Cookie)
+
+// SetCookie sets a cookie on the response for path "/", HttpOnly, Secure
+// and SameSite=Lax unless changed by opts.
+func (c *Context) SetCookie(name, value string, opts ...CookieOption) {
+	http.SetCookie(c.writer, newCookie(name, value, opts))
+}
+
+// DeleteCookie removes a cookie from the client. Path and domain options
+// must match those the cookie was set with.
+func (c *Context) DeleteCookie(name string, opts ...CookieOption) {
+	cookie := newCookie(name, "", opts)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	http.SetCookie(c.writer, cookie)
+}
+
+func newCookie(name, value string, opts []CookieOption) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		opt(cookie)
+	}
+	return cookie
+}
+
+// CookieMaxAge makes the cookie expire after d, rounded down to seconds.
+func CookieMaxAge(d time.Duration) CookieOption {
+	return func(c *http.Cookie) {
+		c.MaxAge = int(d / time.Second)
+	}
+}
+
+// CookieDomain sets the domain the cookie is sent to.
+func CookieDomain(domain string) CookieOption {
+	return func(c *http.Cookie) {
+		c.Domain = domain
+	}
+}
+
+// CookiePath sets the path the cookie is sent to.
+func CookiePath(path string) CookieOption {
+	return func(c *http.Cookie) {
+		c.Path = path
+	}
+}
+
+// CookieSameSite sets the SameSite attribute of the cookie.
+func CookieSameSite(mode http.SameSite) CookieOption {
+	return func(c *http.Cookie) {
+		c.SameSite = mode
+	}
+}
+
+// CookieInsecure lets the cookie be sent over plain HTTP, e.g. for local
+// development.
+func CookieInsecure() CookieOption {
+	return func(c *http.Cookie) {
+		c.Secure = false
+	}
+}
+
+// CookieScriptAccess lets client side scripts read the cookie.
+func CookieScriptAccess() CookieOption {
+	return func(c *http.Cookie) {
+		c.HttpOnly = false
+	}
+}
@@ -0,0 +1,38 @@
+package apictx
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LogDeprecatedCalls makes Deprecated log every call of a deprecated
+// route, with the route and the user, to find the clients still relying
+// on it before it is removed.
+var LogDeprecatedCalls bool
+
+// Deprecated marks the response of a deprecated route with the Deprecation
+// header, the Sunset header (RFC 8594) giving the time the route goes away
+// and a Link to the migration guide at link. A zero sunset or an empty
+// link leaves out the respective header. It must be called before the
+// response is written.
+func (c *Context) Deprecated(sunset time.Time, link string) {
+	h := c.writer.Header()
+	h.Set("Deprecation", "true")
+	if !sunset.IsZero() {
+		h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	if link != "" {
+		h.Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"; type="text/html"`, link))
+	}
+
+	if LogDeprecatedCalls {
+		r := c.request
+		user := ""
+		if c.CurrentUser != nil {
+			user = c.CurrentUser.ID()
+		}
+		slog.Info("deprecated route called", "route", r.Pattern, r.Method, r.URL, "user", user, "user_agent", r.UserAgent(), "request_id", RequestID(r))
+	}
+}
@@ -0,0 +1,165 @@
+package apictx
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"sigs.k8s.io/yaml"
+)
+
+// EncoderFunc encodes data as a response body for Context.Negotiate.
+type EncoderFunc func(w io.Writer, data interface{}) error
+
+// DefaultContentType is the format Negotiate uses when the request has no
+// Accept header or accepts any type.
+var DefaultContentType = "application/json"
+
+var (
+	encoders     = map[string]EncoderFunc{}
+	encoderTypes []string // in order of registration, for wildcard matches
+)
+
+// RegisterEncoder sets fn as the response encoder for the given
+// Content-Type, replacing any encoder registered before. It is not safe for
+// concurrent use and should be called during initialization.
+func RegisterEncoder(contentType string, fn EncoderFunc) {
+	contentType = strings.ToLower(contentType)
+	if _, ok := encoders[contentType]; !ok {
+		encoderTypes = append(encoderTypes, contentType)
+	}
+	encoders[contentType] = fn
+}
+
+// Negotiate writes data in the format preferred by the Accept header of
+// the request among the registered encoders. Requests accepting none of
+// them are answered with 406 Not Acceptable.
+func (c *Context) Negotiate(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	contentType, ok := negotiateType(c.request.Header.Get("Accept"))
+	if !ok {
+		c.handleError(NewHttpError("none of the accepted content types is supported", nil, http.StatusNotAcceptable))
+		return
+	}
+	var buf bytes.Buffer
+	err := encoders[contentType](&buf, data)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	c.writer.Header().Set("Content-Type", contentType)
+	c.writer.Header().Add("Vary", "Accept")
+	c.writer.WriteHeader(statusCode)
+	c.writer.Write(buf.Bytes())
+}
+
+// negotiateType returns the registered content type best matching an
+// Accept header. Types refused with q=0 are not chosen for a wildcard.
+func negotiateType(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		_, ok := encoders[DefaultContentType]
+		return DefaultContentType, ok
+	}
+
+	type mediaRange struct {
+		mt string
+		q  float64
+	}
+	var ranges []mediaRange
+	refused := map[string]bool{}
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err == nil {
+					q = parsed
+				}
+			}
+		}
+		mt = strings.ToLower(strings.TrimSpace(mt))
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mt, q})
+		} else {
+			refused[mt] = true
+		}
+	}
+	// ranges with q=0 exclude types from the wildcards, e.g. */* does not
+	// stand for application/json in "application/json;q=0, */*"
+	acceptable := func(ct string) bool {
+		typ, _, _ := strings.Cut(ct, "/")
+		return !refused[ct] && !refused[typ+"/*"]
+	}
+	slices.SortStableFunc(ranges, func(a, b mediaRange) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	for _, r := range ranges {
+		if r.mt == "*/*" {
+			if _, ok := encoders[DefaultContentType]; ok && acceptable(DefaultContentType) {
+				return DefaultContentType, true
+			}
+			for _, ct := range encoderTypes {
+				if acceptable(ct) {
+					return ct, true
+				}
+			}
+			continue
+		}
+		if _, ok := encoders[r.mt]; ok {
+			return r.mt, true
+		}
+		if typ, ok := strings.CutSuffix(r.mt, "/*"); ok {
+			for _, ct := range encoderTypes {
+				if strings.HasPrefix(ct, typ+"/") && !refused[ct] {
+					return ct, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func init() {
+	RegisterEncoder("application/json", func(w io.Writer, data interface{}) error {
+		return jsonCodec.NewEncoder(w).Encode(data)
+	})
+
+	xmlEncoder := func(w io.Writer, data interface{}) error {
+		io.WriteString(w, xml.Header)
+		return xml.NewEncoder(w).Encode(data)
+	}
+	RegisterEncoder("application/xml", xmlEncoder)
+	RegisterEncoder("text/xml", xmlEncoder)
+
+	yamlEncoder := func(w io.Writer, data interface{}) error {
+		b, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	RegisterEncoder("application/yaml", yamlEncoder)
+	RegisterEncoder("text/yaml", yamlEncoder)
+
+	msgPackEncoder := func(w io.Writer, data interface{}) error {
+		enc := msgpack.NewEncoder(w)
+		enc.SetCustomStructTag("json")
+		return enc.Encode(data)
+	}
+	RegisterEncoder("application/msgpack", msgPackEncoder)
+	RegisterEncoder("application/x-msgpack", msgPackEncoder)
+
+	RegisterEncoder("application/cbor", func(w io.Writer, data interface{}) error {
+		return cbor.NewEncoder(w).Encode(data)
+	})
+}
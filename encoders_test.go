@@ -0,0 +1,47 @@
+package apictx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/html, application/yaml;q=0.9", "application/yaml"},
+		{"application/xml;q=0.5, application/cbor", "application/cbor"},
+		{"application/json;q=0, */*", "application/xml"},
+		{"application/json;q=0, application/xml;q=0, text/xml;q=0, */*", "application/yaml"},
+		{"text/*;q=0, text/yaml", "text/yaml"},
+		{"text/xml;q=0, text/*", "text/yaml"},
+		{"application/*;q=0, */*", "text/xml"},
+		{"application/json;q=0", ""},
+		{"text/html", ""},
+	}
+	for _, tt := range tests {
+		got, ok := negotiateType(tt.accept)
+		if !ok {
+			got = ""
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept", "application/json;q=0, text/html")
+	w := httptest.NewRecorder()
+	c := NewContext(w, r, nil)
+	c.Negotiate(http.StatusOK, map[string]int{"a": 1})
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("got status %d", w.Code)
+	}
+}
@@ -0,0 +1,681 @@
+package apictx
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ApiErrorResponse struct {
+	Code    interface{}  `json:"code"`
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors,omitempty"`
+	Details interface{}  `json:"details,omitempty"`
+	Cause   error        `json:"-"`
+	Debug   *ErrorDebug  `json:"debug,omitempty"`
+
+	// RequestID correlates the response with the logs of the request.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// DevMode adds the cause chain of errors, and the stack where HttpErrors
+// were created, to error responses. It exposes internals and is meant for
+// local development only.
+var DevMode bool
+
+// ErrorDebug is the debugging information of error responses in DevMode.
+type ErrorDebug struct {
+	Causes []string `json:"causes"`
+	Stack  []string `json:"stack,omitempty"`
+}
+
+// FieldError describes an input field that failed validation.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// HttpError used to handle generic error for the context
+type HttpError struct {
+	err        error
+	msg        string
+	statusCode int
+	fields     []FieldError
+	details    map[string]interface{}
+	code       string
+	headers    http.Header
+	stack      []uintptr // where the error was created, in DevMode
+
+	// problem and problemType are set by AsProblem.
+	problem     bool
+	problemType string
+}
+
+func NewHttpError(msg string, err error, statsuCode ...int) *HttpError {
+	statusCode := http.StatusBadRequest
+
+	if len(statsuCode) == 1 && statsuCode[0] >= 200 && statsuCode[0] <= 520 {
+		statusCode = statsuCode[0]
+	}
+	httpErr := &HttpError{err: err, msg: msg, statusCode: statusCode}
+	if DevMode {
+		pcs := make([]uintptr, 32)
+		httpErr.stack = pcs[:runtime.Callers(2, pcs)]
+	}
+	return httpErr
+}
+
+// ErrNotFound returns a 404 Not Found HttpError.
+func ErrNotFound(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusNotFound)
+}
+
+// ErrUnauthorized returns a 401 Unauthorized HttpError, for requests
+// without valid credentials.
+func ErrUnauthorized(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusUnauthorized)
+}
+
+// ErrForbidden returns a 403 Forbidden HttpError, for authenticated
+// requests lacking permission.
+func ErrForbidden(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusForbidden)
+}
+
+// ErrConflict returns a 409 Conflict HttpError.
+func ErrConflict(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusConflict)
+}
+
+// ErrUnprocessable returns a 422 Unprocessable Entity HttpError.
+func ErrUnprocessable(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusUnprocessableEntity)
+}
+
+// ErrTooManyRequests returns a 429 Too Many Requests HttpError.
+func ErrTooManyRequests(msg string) *HttpError {
+	return NewHttpError(msg, nil, http.StatusTooManyRequests)
+}
+
+// NewRateLimitedError returns a 429 Too Many Requests HttpError telling
+// the client to retry after the given duration in its Retry-After header.
+func NewRateLimitedError(after time.Duration) *HttpError {
+	return ErrTooManyRequests("too many requests").WithHeader("Retry-After", retryAfter(after))
+}
+
+// NewUnavailableError returns a 503 Service Unavailable HttpError telling
+// the client to retry after the given duration in its Retry-After header.
+func NewUnavailableError(after time.Duration) *HttpError {
+	return NewHttpError("service unavailable", nil, http.StatusServiceUnavailable).WithHeader("Retry-After", retryAfter(after))
+}
+
+// retryAfter formats d as Retry-After seconds, rounded up so clients do
+// not retry early.
+func retryAfter(d time.Duration) string {
+	return strconv.FormatInt(seconds(d+time.Second-1), 10)
+}
+
+func (e HttpError) Error() string {
+	return e.msg
+}
+
+func (e HttpError) Cause() error {
+	return e.err
+}
+
+func (e HttpError) Status() int {
+	return e.statusCode
+}
+
+// Unwrap returns the cause, so errors.Is and errors.As see through the
+// HttpError.
+func (e HttpError) Unwrap() error {
+	return e.err
+}
+
+// Fields returns the input fields that failed validation, if any.
+func (e HttpError) Fields() []FieldError {
+	return e.fields
+}
+
+// Details returns the structured details of e, as added with WithField
+// and WithDetails, and for validation errors the messages of each failing
+// field keyed by its path.
+func (e HttpError) Details() map[string]interface{} {
+	return e.details
+}
+
+// Code returns the application error code of e, empty unless it was
+// created with NewCodedError.
+func (e HttpError) Code() string {
+	return e.code
+}
+
+var errorCodes = map[string]int{}
+
+// RegisterErrorCode declares an application error code and the HTTP status
+// it is answered with, e.g. apictx.RegisterErrorCode("USER_NOT_FOUND", 404).
+// It is not safe for concurrent use and should be called during
+// initialization.
+func RegisterErrorCode(code string, status int) {
+	errorCodes[code] = status
+}
+
+// ErrorCodes returns the registered error codes and their statuses, for
+// publishing them to API clients.
+func ErrorCodes() map[string]int {
+	return maps.Clone(errorCodes)
+}
+
+// errorMessages holds the translations of error messages by code, then
+// by lower case locale.
+var errorMessages = map[string]map[string]string{}
+
+// RegisterErrorMessage adds the message of the errors with an application
+// code in a language, chosen from the Accept-Language header of the
+// request, e.g. apictx.RegisterErrorMessage("USER_NOT_FOUND", "de",
+// "Benutzer nicht gefunden"). Locales are language tags such as "pt-BR" or
+// "pt". The message of the error is sent when no accepted language has a
+// translation, and logs keep it either way. It is not safe for concurrent
+// use and should be called during initialization.
+func RegisterErrorMessage(code, locale, msg string) {
+	if errorMessages[code] == nil {
+		errorMessages[code] = map[string]string{}
+	}
+	errorMessages[code][strings.ToLower(strings.ReplaceAll(locale, "-", "_"))] = msg
+}
+
+// localizedMessage returns the translation of the message of code in the
+// most preferred language of an Accept-Language header that has one.
+func localizedMessage(code, acceptLanguage string) (string, bool) {
+	translations := errorMessages[code]
+	if translations == nil {
+		return "", false
+	}
+	for _, tag := range acceptedLanguages(acceptLanguage) {
+		if msg, ok := translations[strings.ToLower(tag)]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// NewCodedError returns an HttpError with a registered application code,
+// answered with the status registered for it and the code in the code
+// field of the response. Unregistered codes are answered with 500.
+func NewCodedError(code, msg string, err error) *HttpError {
+	status, ok := errorCodes[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	httpErr := NewHttpError(msg, err, status)
+	httpErr.code = code
+	return httpErr
+}
+
+// AsProblem makes HandleError answer e with an RFC 7807 problem+json body
+// even when ProblemJSON is off. typeURI identifies the kind of problem, an
+// empty one means about:blank.
+func (e *HttpError) AsProblem(typeURI string) *HttpError {
+	e.problem = true
+	e.problemType = typeURI
+	return e
+}
+
+// WithField adds key to the details of e, e.g. the ID of the resource
+// that caused it.
+func (e *HttpError) WithField(key string, value interface{}) *HttpError {
+	if e.details == nil {
+		e.details = map[string]interface{}{}
+	}
+	e.details[key] = value
+	return e
+}
+
+// WithDetails adds the entries of details to the details of e.
+func (e *HttpError) WithDetails(details map[string]interface{}) *HttpError {
+	for k, v := range details {
+		e.WithField(k, v)
+	}
+	return e
+}
+
+// WithHeader adds a header to the response of e, such as WWW-Authenticate
+// on 401 or Retry-After on 503.
+func (e *HttpError) WithHeader(key, value string) *HttpError {
+	if e.headers == nil {
+		e.headers = http.Header{}
+	}
+	e.headers.Add(key, value)
+	return e
+}
+
+// ProblemJSON makes HandleError answer every error with an RFC 7807
+// application/problem+json body instead of an ApiErrorResponse.
+var ProblemJSON bool
+
+// ProblemDetails is the RFC 7807 body of error responses in problem+json
+// mode. Code, Errors and Details are extension members.
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     interface{}  `json:"code,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+	Details  interface{}  `json:"details,omitempty"`
+	Debug    *ErrorDebug  `json:"debug,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// StatusCoder is implemented by errors carrying their HTTP status, so
+// packages can define errors answered by HandleError without importing
+// apictx. Their message is sent to the client like that of an HttpError.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// ErrorCoder is implemented by StatusCoder errors carrying an application
+// error code, sent in place of the generic one.
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// asStatusCoder sets target to an HttpError for the first StatusCoder in
+// the chain of err.
+func asStatusCoder(err error, target **HttpError) bool {
+	var sc StatusCoder
+	if !errors.As(err, &sc) {
+		return false
+	}
+	status := sc.StatusCode()
+	if status < 200 || status > 520 {
+		status = http.StatusInternalServerError
+	}
+	httpErr := &HttpError{err: err, msg: sc.(error).Error(), statusCode: status}
+	if ec, ok := sc.(ErrorCoder); ok {
+		httpErr.code = ec.ErrorCode()
+	}
+	*target = httpErr
+	return true
+}
+
+// StatusClientClosedRequest is the non-standard status of requests whose
+// client went away before the response, as logged by nginx.
+const StatusClientClosedRequest = 499
+
+type errorMapping struct {
+	target error
+	status int
+	msg    string
+}
+
+// errorMappings are the errors answered with a status of their own, in the
+// order they are matched.
+var errorMappings = []errorMapping{
+	{sql.ErrNoRows, http.StatusNotFound, "not found"},
+	{context.DeadlineExceeded, http.StatusGatewayTimeout, "request timed out"},
+	{context.Canceled, StatusClientClosedRequest, "request canceled"},
+}
+
+// MapError makes HandleError answer errors matching target, as by
+// errors.Is, with status and msg instead of 500 Internal Error, so
+// handlers can return them as is. sql.ErrNoRows, context.DeadlineExceeded
+// and context.Canceled are mapped by default; a status of 0 removes the
+// mapping of target. It is not safe for concurrent use and should be
+// called during initialization.
+func MapError(target error, status int, msg string) {
+	errorMappings = slices.DeleteFunc(errorMappings, func(m errorMapping) bool {
+		return m.target == target
+	})
+	if status != 0 {
+		errorMappings = append(errorMappings, errorMapping{target, status, msg})
+	}
+}
+
+// asMappedError sets target to an HttpError for the first mapping err
+// matches.
+func asMappedError(err error, target **HttpError) bool {
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			*target = &HttpError{err: err, msg: m.msg, statusCode: m.status}
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorTemplate is the template that HandleError renders, with the
+// Renderer set by SetRenderer, for clients preferring text/html over JSON,
+// such as browsers navigating to a page. The template is executed with an
+// ErrorPage. Errors are answered as JSON when it is empty.
+var ErrorTemplate string
+
+// ErrorPage is the data of the ErrorTemplate.
+type ErrorPage struct {
+	Status int
+	Title  string // the status text, e.g. "Not Found"
+	ApiErrorResponse
+}
+
+// prefersHTML reports whether an Accept header ranks text/html above
+// JSON. Wildcards do not count, so API clients accepting anything still
+// get JSON.
+func prefersHTML(accept string) bool {
+	var html, json float64
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err == nil {
+					q = parsed
+				}
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(mt)) {
+		case "text/html", "application/xhtml+xml":
+			html = max(html, q)
+		case "application/json", "application/problem+json":
+			json = max(json, q)
+		}
+	}
+	return html > json
+}
+
+var errorEncoder func(err *HttpError, requestID string) interface{}
+
+// SetErrorEncoder sets fn to build the JSON bodies of error responses in
+// place of ApiErrorResponse, for APIs with an error format of their own.
+// Errors other than HttpErrors are passed as a 500 with the generic
+// internal error message, their cause being the original error. It is not
+// safe for concurrent use and should be called during initialization.
+func SetErrorEncoder(fn func(err *HttpError, requestID string) interface{}) {
+	errorEncoder = fn
+}
+
+// ErrorHandlerFunc translates an error into the status and body of its
+// response, see SetErrorHandler.
+type ErrorHandlerFunc func(c *Context, err error) (int, interface{})
+
+var errorHandler ErrorHandlerFunc
+
+// SetErrorHandler sets fn to translate errors before HandleError answers
+// them, e.g. to map domain errors in one place. A nil body leaves the error
+// to the default handling, and a body that is an error, such as an
+// *HttpError, is handled in place of the original one. Other bodies are
+// written as JSON with the returned status. It is not safe for concurrent
+// use and should be called during initialization.
+func SetErrorHandler(fn ErrorHandlerFunc) {
+	errorHandler = fn
+}
+
+// OnInternalError sets fn to be called with the context of the request
+// for errors answered with a 5xx status, e.g. to report them to a crash
+// reporting service with the request and the CurrentUser. It is not safe
+// for concurrent use and should be called during initialization.
+func OnInternalError(fn func(ctx *Context, err error)) {
+	internalErrorHook = fn
+}
+
+var internalErrorHook func(ctx *Context, err error)
+
+// ErrorMetric describes an error answered by HandleError, see
+// OnErrorMetric.
+type ErrorMetric struct {
+	Status int
+	Class  string // the status class, e.g. "4xx"
+	Code   string // the application error code, if any
+	Route  string // the ServeMux pattern of the request, e.g. "GET /users/{id}"
+}
+
+var errorMetricHook func(m ErrorMetric)
+
+// OnErrorMetric sets fn to be called for every error answered by
+// HandleError, including the requests whose client went away, e.g. to
+// count errors by class and route for alerting. It is not safe for
+// concurrent use and should be called during initialization.
+func OnErrorMetric(fn func(m ErrorMetric)) {
+	errorMetricHook = fn
+}
+
+func reportError(r *http.Request, status int, code string) {
+	if errorMetricHook == nil {
+		return
+	}
+	errorMetricHook(ErrorMetric{
+		Status: status,
+		Class:  fmt.Sprintf("%dxx", status/100),
+		Code:   code,
+		Route:  r.Pattern,
+	})
+}
+
+// HandleError answers err. HttpErrors, StatusCoder errors and the errors
+// mapped with MapError are answered with their status and message, other
+// errors with 500, or overRideStatusCode when given, and a generic
+// message. The error handler set with SetErrorHandler runs first. The
+// body is, in order of precedence, the ErrorTemplate page for clients
+// preferring HTML, the body built by the SetErrorEncoder function, a
+// ProblemDetails with ProblemJSON or AsProblem, or else an
+// ApiErrorResponse, wrapped in an Envelope with EnvelopeErrors.
+func HandleError(w http.ResponseWriter, r *http.Request, err error, overRideStatusCode ...int) {
+	ctx := Context{writer: w, request: r}
+	ctx.handleError(err, overRideStatusCode...)
+}
+
+// handleError answers err like HandleError, with the context of the
+// request passed to the error handler and hooks.
+func (c *Context) handleError(err error, overRideStatusCode ...int) {
+	w, r := c.writer, c.request
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		// the client went away, there is no one to answer
+		slog.Debug("client closed request", "status", StatusClientClosedRequest, "error", err, r.Method, r.URL, "request_id", RequestID(r))
+		w.WriteHeader(StatusClientClosedRequest)
+		reportError(r, StatusClientClosedRequest, "")
+		return
+	}
+	if errorHandler != nil {
+		status, body := errorHandler(c, err)
+		switch body := body.(type) {
+		case nil:
+		case error:
+			err = body
+		default:
+			if status == 0 {
+				status = http.StatusInternalServerError
+			}
+			w.Header().Set("Content-Type", "application/json;charset=utf-8")
+			w.WriteHeader(status)
+			jsonCodec.NewEncoder(w).Encode(body)
+			reportError(r, status, "")
+			return
+		}
+	}
+
+	requestID := RequestID(r)
+	if requestID == "" {
+		requestID = newRequestID()
+		w.Header().Set(RequestIDHeader, requestID)
+	}
+
+	var errRes ApiErrorResponse
+	statusCode := http.StatusInternalServerError
+
+	if len(overRideStatusCode) == 1 {
+		statusCode = overRideStatusCode[0]
+	}
+
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) || asStatusCoder(err, &httpErr) || asMappedError(err, &httpErr) {
+		slog.Debug("api error: "+httpErr.Error(), "error", httpErr.Cause(), r.Method, r.URL, "request_id", requestID)
+		statusCode = httpErr.Status()
+		for k, v := range httpErr.headers {
+			w.Header()[k] = v
+		}
+		errRes = ApiErrorResponse{Code: 0x6400, Message: httpErr.Error(), Cause: httpErr.Cause()}
+		if httpErr.code != "" {
+			errRes.Code = httpErr.code
+			if msg, ok := localizedMessage(httpErr.code, r.Header.Get("Accept-Language")); ok {
+				errRes.Message = msg
+			}
+		}
+		if !FlatValidationErrors {
+			errRes.Errors = httpErr.Fields()
+		}
+		if httpErr.fields == nil {
+			errRes.Errors = joinedErrors(httpErr.err)
+		}
+		if details := httpErr.Details(); len(details) > 0 && (!FlatValidationErrors || httpErr.fields == nil) {
+			errRes.Details = details
+		}
+	} else {
+		slog.Warn("internal error", "error", err, r.Method, r.URL, "request_id", requestID)
+		errRes = ApiErrorResponse{Code: 0x0, Message: "Internal error"}
+	}
+	errRes.RequestID = requestID
+	if internalErrorHook != nil && statusCode >= 500 {
+		internalErrorHook(c, err)
+	}
+	if httpErr != nil {
+		reportError(r, statusCode, httpErr.code)
+	} else {
+		reportError(r, statusCode, "")
+	}
+	if DevMode {
+		errRes.Debug = newErrorDebug(err, httpErr)
+	}
+
+	if ErrorTemplate != "" && renderer != nil {
+		w.Header().Add("Vary", "Accept")
+		if prefersHTML(r.Header.Get("Accept")) {
+			var buf bytes.Buffer
+			err := renderer.Render(&buf, ErrorTemplate, ErrorPage{Status: statusCode, Title: http.StatusText(statusCode), ApiErrorResponse: errRes})
+			if err == nil {
+				w.Header().Set("Content-Type", "text/html;charset=utf-8")
+				w.WriteHeader(statusCode)
+				w.Write(buf.Bytes())
+				return
+			}
+			slog.Warn("failed to render error page", "error", err, r.Method, r.URL, "request_id", requestID)
+		}
+	}
+
+	if errorEncoder != nil {
+		encErr := httpErr
+		if encErr == nil {
+			encErr = &HttpError{err: err, msg: errRes.Message, statusCode: statusCode}
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		w.WriteHeader(statusCode)
+		jsonCodec.NewEncoder(w).Encode(errorEncoder(encErr, requestID))
+		return
+	}
+
+	if ProblemJSON || (httpErr != nil && httpErr.problem) {
+		problem := ProblemDetails{
+			Type:     "about:blank",
+			Title:    http.StatusText(statusCode),
+			Status:   statusCode,
+			Detail:   errRes.Message,
+			Instance: r.URL.Path,
+			Code:     errRes.Code,
+			Errors:   errRes.Errors,
+			Details:  errRes.Details,
+			Debug:    errRes.Debug,
+
+			RequestID: errRes.RequestID,
+		}
+		if httpErr != nil && httpErr.problemType != "" {
+			problem.Type = httpErr.problemType
+		}
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(statusCode)
+		jsonCodec.NewEncoder(w).Encode(problem)
+		return
+	}
+
+	var body interface{} = errRes
+	if EnvelopeErrors {
+		body = Envelope{Error: &errRes}
+	}
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(statusCode)
+	jsonCodec.NewEncoder(w).Encode(body)
+}
+
+// newErrorDebug describes err and its causes, depth first through joined
+// errors, with the stack of the HttpError found in it.
+func newErrorDebug(err error, httpErr *HttpError) *ErrorDebug {
+	debug := &ErrorDebug{}
+	var walk func(err error)
+	walk = func(err error) {
+		for err != nil {
+			debug.Causes = append(debug.Causes, fmt.Sprintf("%s (%T)", err, err))
+			switch e := err.(type) {
+			case interface{ Unwrap() []error }:
+				for _, inner := range e.Unwrap() {
+					walk(inner)
+				}
+				return
+			case interface{ Unwrap() error }:
+				err = e.Unwrap()
+			default:
+				return
+			}
+		}
+	}
+	walk(err)
+
+	if httpErr != nil {
+		frames := runtime.CallersFrames(httpErr.stack)
+		for {
+			frame, more := frames.Next()
+			if frame.Function != "" {
+				debug.Stack = append(debug.Stack, fmt.Sprintf("%s %s:%d", frame.Function, frame.File, frame.Line))
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return debug
+}
+
+// joinedErrors returns an entry for each of the errors joined in err, as
+// by errors.Join, or nil when err is not a joined error. The fields of
+// joined validation errors are listed individually.
+func joinedErrors(err error) []FieldError {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	var entries []FieldError
+	for _, e := range joined.Unwrap() {
+		var httpErr *HttpError
+		switch {
+		case errors.As(e, &httpErr) && httpErr.fields != nil:
+			entries = append(entries, httpErr.fields...)
+		case errors.As(e, &httpErr):
+			entries = append(entries, FieldError{Message: httpErr.Error()})
+		default:
+			entries = append(entries, FieldError{Message: e.Error()})
+		}
+	}
+	return entries
+}
@@ -0,0 +1,495 @@
+package apictx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statusError is an error of another package carrying its status.
+type statusError struct {
+	status int
+	code   string
+}
+
+func (e statusError) Error() string   { return "payment required" }
+func (e statusError) StatusCode() int { return e.status }
+
+type codedStatusError struct{ statusError }
+
+func (e codedStatusError) ErrorCode() string { return e.code }
+
+type rendererFunc func(w io.Writer, name string, data interface{}) error
+
+func (f rendererFunc) Render(w io.Writer, name string, data interface{}) error {
+	return f(w, name, data)
+}
+
+// resetErrorSettings restores the settings of error responses changed by
+// a test.
+func resetErrorSettings(t *testing.T) {
+	problemJSON, envelope, devMode, flat := ProblemJSON, EnvelopeErrors, DevMode, FlatValidationErrors
+	encoder, handler, internalHook, metricHook := errorEncoder, errorHandler, internalErrorHook, errorMetricHook
+	template, r := ErrorTemplate, renderer
+	t.Cleanup(func() {
+		ProblemJSON, EnvelopeErrors, DevMode, FlatValidationErrors = problemJSON, envelope, devMode, flat
+		errorEncoder, errorHandler, internalErrorHook, errorMetricHook = encoder, handler, internalHook, metricHook
+		ErrorTemplate, renderer = template, r
+	})
+}
+
+func validationFailure() *HttpError {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	var data struct {
+		Email string `json:"email" validate:"required"`
+	}
+	return newTestContext(r).Bind(&data)
+}
+
+func TestHandleError(t *testing.T) {
+	RegisterErrorCode("TEST_NOT_FOUND", http.StatusNotFound)
+	RegisterErrorMessage("TEST_NOT_FOUND", "de", "nicht gefunden")
+	t.Cleanup(func() {
+		delete(errorCodes, "TEST_NOT_FOUND")
+		delete(errorMessages, "TEST_NOT_FOUND")
+	})
+
+	const jsonType = "application/json;charset=utf-8"
+	tests := []struct {
+		name     string
+		setup    func()
+		err      func() error
+		override []int
+		header   http.Header
+		status   int
+		headers  map[string]string
+		body     string
+	}{
+		{
+			name:    "http error",
+			err:     func() error { return NewHttpError("bad input", errors.New("cause"), http.StatusBadRequest) },
+			status:  http.StatusBadRequest,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"code":25600,"message":"bad input","request_id":"r1"}`,
+		},
+		{
+			name:    "wrapped http error",
+			err:     func() error { return fmt.Errorf("load: %w", ErrNotFound("no such user")) },
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"code":25600,"message":"no such user","request_id":"r1"}`,
+		},
+		{
+			name:    "internal error",
+			err:     func() error { return errors.New("secret") },
+			status:  http.StatusInternalServerError,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"code":0,"message":"Internal error","request_id":"r1"}`,
+		},
+		{
+			name:     "status override",
+			err:      func() error { return errors.New("secret") },
+			override: []int{http.StatusServiceUnavailable},
+			status:   http.StatusServiceUnavailable,
+			body:     `{"code":0,"message":"Internal error","request_id":"r1"}`,
+		},
+		{
+			name:   "status coder",
+			err:    func() error { return fmt.Errorf("charge: %w", statusError{status: http.StatusPaymentRequired}) },
+			status: http.StatusPaymentRequired,
+			body:   `{"code":25600,"message":"payment required","request_id":"r1"}`,
+		},
+		{
+			name:   "status coder with code",
+			err:    func() error { return codedStatusError{statusError{http.StatusPaymentRequired, "CARD_DECLINED"}} },
+			status: http.StatusPaymentRequired,
+			body:   `{"code":"CARD_DECLINED","message":"payment required","request_id":"r1"}`,
+		},
+		{
+			name:   "status coder out of range",
+			err:    func() error { return statusError{status: 99} },
+			status: http.StatusInternalServerError,
+			body:   `{"code":25600,"message":"payment required","request_id":"r1"}`,
+		},
+		{
+			name:   "mapped error",
+			err:    func() error { return fmt.Errorf("find user: %w", sql.ErrNoRows) },
+			status: http.StatusNotFound,
+			body:   `{"code":25600,"message":"not found","request_id":"r1"}`,
+		},
+		{
+			name:   "deadline",
+			err:    func() error { return context.DeadlineExceeded },
+			status: http.StatusGatewayTimeout,
+			body:   `{"code":25600,"message":"request timed out","request_id":"r1"}`,
+		},
+		{
+			name:   "coded error",
+			err:    func() error { return NewCodedError("TEST_NOT_FOUND", "user not found", nil) },
+			status: http.StatusNotFound,
+			body:   `{"code":"TEST_NOT_FOUND","message":"user not found","request_id":"r1"}`,
+		},
+		{
+			name:   "localized coded error",
+			err:    func() error { return NewCodedError("TEST_NOT_FOUND", "user not found", nil) },
+			header: http.Header{"Accept-Language": {"fr;q=0.9, de-CH"}},
+			status: http.StatusNotFound,
+			body:   `{"code":"TEST_NOT_FOUND","message":"nicht gefunden","request_id":"r1"}`,
+		},
+		{
+			name:   "unregistered code",
+			err:    func() error { return NewCodedError("TEST_UNKNOWN", "oops", nil) },
+			status: http.StatusInternalServerError,
+			body:   `{"code":"TEST_UNKNOWN","message":"oops","request_id":"r1"}`,
+		},
+		{
+			name:    "rate limited",
+			err:     func() error { return NewRateLimitedError(1500 * time.Millisecond) },
+			status:  http.StatusTooManyRequests,
+			headers: map[string]string{"Retry-After": "2"},
+			body:    `{"code":25600,"message":"too many requests","request_id":"r1"}`,
+		},
+		{
+			name:    "unavailable",
+			err:     func() error { return NewUnavailableError(time.Minute) },
+			status:  http.StatusServiceUnavailable,
+			headers: map[string]string{"Retry-After": "60"},
+			body:    `{"code":25600,"message":"service unavailable","request_id":"r1"}`,
+		},
+		{
+			name: "fields and headers",
+			err: func() error {
+				return ErrUnauthorized("token expired").WithField("realm", "api").WithHeader("WWW-Authenticate", `Bearer realm="api"`)
+			},
+			status:  http.StatusUnauthorized,
+			headers: map[string]string{"WWW-Authenticate": `Bearer realm="api"`},
+			body:    `{"code":25600,"message":"token expired","details":{"realm":"api"},"request_id":"r1"}`,
+		},
+		{
+			name:   "validation",
+			err:    func() error { return validationFailure() },
+			status: http.StatusBadRequest,
+			body:   `{"code":25600,"message":"validation error(s): email is a required field","errors":[{"field":"email","rule":"required","message":"email is a required field"}],"details":{"email":["email is a required field"]},"request_id":"r1"}`,
+		},
+		{
+			name:   "flat validation",
+			setup:  func() { FlatValidationErrors = true },
+			err:    func() error { return validationFailure() },
+			status: http.StatusBadRequest,
+			body:   `{"code":25600,"message":"validation error(s): email is a required field","request_id":"r1"}`,
+		},
+		{
+			name: "joined",
+			err: func() error {
+				return NewHttpError("invalid booking", errors.Join(errors.New("unknown plan"), validationFailure()), 422)
+			},
+			status: http.StatusUnprocessableEntity,
+			body:   `{"code":25600,"message":"invalid booking","errors":[{"message":"unknown plan"},{"field":"email","rule":"required","message":"email is a required field"}],"request_id":"r1"}`,
+		},
+		{
+			name:    "problem json",
+			setup:   func() { ProblemJSON = true },
+			err:     func() error { return ErrNotFound("no such thing") },
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			body:    `{"type":"about:blank","title":"Not Found","status":404,"detail":"no such thing","instance":"/things/1","code":25600,"request_id":"r1"}`,
+		},
+		{
+			name:    "problem json internal error",
+			setup:   func() { ProblemJSON = true },
+			err:     func() error { return errors.New("secret") },
+			status:  http.StatusInternalServerError,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			body:    `{"type":"about:blank","title":"Internal Server Error","status":500,"detail":"Internal error","instance":"/things/1","code":0,"request_id":"r1"}`,
+		},
+		{
+			name:    "as problem",
+			err:     func() error { return ErrConflict("taken").AsProblem("https://example.com/problems/taken") },
+			status:  http.StatusConflict,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			body:    `{"type":"https://example.com/problems/taken","title":"Conflict","status":409,"detail":"taken","instance":"/things/1","code":25600,"request_id":"r1"}`,
+		},
+		{
+			name:   "envelope",
+			setup:  func() { EnvelopeErrors = true },
+			err:    func() error { return ErrNotFound("no such thing") },
+			status: http.StatusNotFound,
+			body:   `{"data":null,"meta":null,"error":{"code":25600,"message":"no such thing","request_id":"r1"}}`,
+		},
+		{
+			name:    "problem json over envelope",
+			setup:   func() { ProblemJSON, EnvelopeErrors = true, true },
+			err:     func() error { return ErrNotFound("no such thing") },
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": "application/problem+json"},
+			body:    `{"type":"about:blank","title":"Not Found","status":404,"detail":"no such thing","instance":"/things/1","code":25600,"request_id":"r1"}`,
+		},
+		{
+			name: "encoder over problem json and envelope",
+			setup: func() {
+				ProblemJSON, EnvelopeErrors = true, true
+				SetErrorEncoder(func(err *HttpError, requestID string) interface{} {
+					return map[string]interface{}{"error": err.Error(), "status": err.Status(), "trace": requestID}
+				})
+			},
+			err:     func() error { return ErrNotFound("no such thing") },
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"error":"no such thing","status":404,"trace":"r1"}`,
+		},
+		{
+			name: "encoder internal error",
+			setup: func() {
+				SetErrorEncoder(func(err *HttpError, requestID string) interface{} {
+					return map[string]interface{}{"error": err.Error(), "cause": err.Cause().Error()}
+				})
+			},
+			err:    func() error { return errors.New("secret") },
+			status: http.StatusInternalServerError,
+			body:   `{"cause":"secret","error":"Internal error"}`,
+		},
+		{
+			name: "error handler body",
+			setup: func() {
+				SetErrorHandler(func(c *Context, err error) (int, interface{}) {
+					return http.StatusTeapot, map[string]string{"handled": err.Error()}
+				})
+			},
+			err:     func() error { return errors.New("domain") },
+			status:  http.StatusTeapot,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"handled":"domain"}`,
+		},
+		{
+			name: "error handler error",
+			setup: func() {
+				SetErrorHandler(func(c *Context, err error) (int, interface{}) {
+					return 0, ErrConflict("translated: " + err.Error())
+				})
+			},
+			err:    func() error { return errors.New("domain") },
+			status: http.StatusConflict,
+			body:   `{"code":25600,"message":"translated: domain","request_id":"r1"}`,
+		},
+		{
+			name: "error handler without body",
+			setup: func() {
+				SetErrorHandler(func(c *Context, err error) (int, interface{}) { return http.StatusTeapot, nil })
+			},
+			err:    func() error { return ErrNotFound("no such thing") },
+			status: http.StatusNotFound,
+			body:   `{"code":25600,"message":"no such thing","request_id":"r1"}`,
+		},
+		{
+			name: "error page",
+			setup: func() {
+				ErrorTemplate = "error.html"
+				SetRenderer(rendererFunc(func(w io.Writer, name string, data interface{}) error {
+					page := data.(ErrorPage)
+					_, err := fmt.Fprintf(w, "<h1>%d %s</h1><p>%s</p><p>%s</p>", page.Status, page.Title, page.Message, page.RequestID)
+					return err
+				}))
+			},
+			err:     func() error { return ErrNotFound("no such thing") },
+			header:  http.Header{"Accept": {"text/html,application/xhtml+xml,*/*;q=0.8"}},
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": "text/html;charset=utf-8", "Vary": "Accept"},
+			body:    `<h1>404 Not Found</h1><p>no such thing</p><p>r1</p>`,
+		},
+		{
+			name: "error page over encoder",
+			setup: func() {
+				ErrorTemplate = "error.html"
+				SetRenderer(rendererFunc(func(w io.Writer, name string, data interface{}) error {
+					_, err := io.WriteString(w, "page")
+					return err
+				}))
+				SetErrorEncoder(func(err *HttpError, requestID string) interface{} { return "encoded" })
+			},
+			err:     func() error { return errors.New("secret") },
+			header:  http.Header{"Accept": {"text/html"}},
+			status:  http.StatusInternalServerError,
+			headers: map[string]string{"Content-Type": "text/html;charset=utf-8"},
+			body:    `page`,
+		},
+		{
+			name: "error page for API clients",
+			setup: func() {
+				ErrorTemplate = "error.html"
+				SetRenderer(rendererFunc(func(w io.Writer, name string, data interface{}) error {
+					_, err := io.WriteString(w, "page")
+					return err
+				}))
+			},
+			err:     func() error { return ErrNotFound("no such thing") },
+			header:  http.Header{"Accept": {"*/*"}},
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": jsonType, "Vary": "Accept"},
+			body:    `{"code":25600,"message":"no such thing","request_id":"r1"}`,
+		},
+		{
+			name: "failing error page",
+			setup: func() {
+				ErrorTemplate = "error.html"
+				SetRenderer(rendererFunc(func(w io.Writer, name string, data interface{}) error {
+					return errors.New("missing template")
+				}))
+			},
+			err:     func() error { return ErrNotFound("no such thing") },
+			header:  http.Header{"Accept": {"text/html"}},
+			status:  http.StatusNotFound,
+			headers: map[string]string{"Content-Type": jsonType},
+			body:    `{"code":25600,"message":"no such thing","request_id":"r1"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetErrorSettings(t)
+			if tt.setup != nil {
+				tt.setup()
+			}
+			r := httptest.NewRequest(http.MethodGet, "/things/1", nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			r.Header.Set(RequestIDHeader, "r1")
+			w := httptest.NewRecorder()
+			HandleError(w, r, tt.err(), tt.override...)
+
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+			for k, want := range tt.headers {
+				if got := w.Header().Get(k); got != want {
+					t.Errorf("got %s %q, want %q", k, got, want)
+				}
+			}
+			if got := strings.TrimSpace(w.Body.String()); got != tt.body {
+				t.Errorf("got body\n%s\nwant\n%s", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestHandleErrorRequestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	HandleError(w, httptest.NewRequest(http.MethodGet, "/", nil), ErrNotFound("missing"))
+
+	var body ApiErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID == "" || w.Header().Get(RequestIDHeader) != body.RequestID {
+		t.Errorf("got request_id %q and header %q", body.RequestID, w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestHandleErrorDevMode(t *testing.T) {
+	resetErrorSettings(t)
+	DevMode = true
+	tests := []struct {
+		name    string
+		err     error
+		message string
+		causes  []string
+	}{
+		{
+			"http error",
+			NewHttpError("bad input", errors.New("cause"), http.StatusBadRequest),
+			"bad input",
+			[]string{"bad input (*apictx.HttpError)", "cause (*errors.errorString)"},
+		},
+		{
+			"internal error",
+			fmt.Errorf("load: %w", errors.New("secret")),
+			"Internal error",
+			[]string{"load: secret (*fmt.wrapError)", "secret (*errors.errorString)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			HandleError(w, httptest.NewRequest(http.MethodGet, "/", nil), tt.err)
+
+			var body ApiErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Message != tt.message || body.Debug == nil || strings.Join(body.Debug.Causes, "|") != strings.Join(tt.causes, "|") {
+				t.Fatalf("got %s", w.Body)
+			}
+			var httpErr *HttpError
+			if wantStack := errors.As(tt.err, &httpErr); wantStack != (len(body.Debug.Stack) > 0) {
+				t.Errorf("got stack %v", body.Debug.Stack)
+			}
+		})
+	}
+}
+
+func TestHandleErrorHooks(t *testing.T) {
+	resetErrorSettings(t)
+	var internal []error
+	var metrics []ErrorMetric
+	OnInternalError(func(ctx *Context, err error) { internal = append(internal, err) })
+	OnErrorMetric(func(m ErrorMetric) { metrics = append(metrics, m) })
+	RegisterErrorCode("TEST_GONE", http.StatusGone)
+	t.Cleanup(func() { delete(errorCodes, "TEST_GONE") })
+
+	mux := http.NewServeMux()
+	errs := map[string]error{
+		"/bad":      ErrUnprocessable("invalid"),
+		"/coded":    NewCodedError("TEST_GONE", "gone", nil),
+		"/internal": errors.New("secret"),
+	}
+	mux.Handle("GET /items/{name...}", Handler(func(c *Context) error {
+		return errs[strings.TrimPrefix(c.Request().URL.Path, "/items")]
+	}))
+	for _, path := range []string{"/bad", "/coded", "/internal"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/items"+path, nil))
+	}
+
+	if len(internal) != 1 || internal[0] != errs["/internal"] {
+		t.Errorf("got internal errors %v", internal)
+	}
+	want := []ErrorMetric{
+		{Status: 422, Class: "4xx", Route: "GET /items/{name...}"},
+		{Status: 410, Class: "4xx", Code: "TEST_GONE", Route: "GET /items/{name...}"},
+		{Status: 500, Class: "5xx", Route: "GET /items/{name...}"},
+	}
+	if fmt.Sprint(metrics) != fmt.Sprint(want) {
+		t.Errorf("got metrics %v, want %v", metrics, want)
+	}
+}
+
+func TestHandleErrorClientGone(t *testing.T) {
+	resetErrorSettings(t)
+	var internal bool
+	var metrics []ErrorMetric
+	OnInternalError(func(ctx *Context, err error) { internal = true })
+	OnErrorMetric(func(m ErrorMetric) { metrics = append(metrics, m) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+	HandleError(w, r, errors.New("write: broken pipe"))
+
+	if w.Code != StatusClientClosedRequest || w.Body.Len() != 0 {
+		t.Errorf("got status %d with body %q", w.Code, w.Body)
+	}
+	if internal {
+		t.Error("internal error hook called for a client that went away")
+	}
+	if len(metrics) != 1 || metrics[0].Status != StatusClientClosedRequest || metrics[0].Class != "4xx" {
+		t.Errorf("got metrics %v", metrics)
+	}
+}
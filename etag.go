@@ -0,0 +1,46 @@
+package apictx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// JSONWithETag writes data as JSON with an ETag derived from its encoding.
+// GET and HEAD requests whose If-None-Match header holds the same tag are
+// answered with 304 Not Modified and no body.
+func (c *Context) JSONWithETag(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	b, err := jsonCodec.Marshal(data)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	b = append(b, '\n')
+	sum := sha256.Sum256(b)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	c.writer.Header().Set("ETag", etag)
+	if (c.request.Method == http.MethodGet || c.request.Method == http.MethodHead) && etagMatch(c.request.Header.Get("If-None-Match"), etag) {
+		c.writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	c.writer.Header().Set("Content-Type", "application/json;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	c.writer.Write(b)
+}
+
+// etagMatch reports whether an If-None-Match header matches etag, using
+// the weak comparison of RFC 9110.
+func etagMatch(ifNoneMatch, etag string) bool {
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,469 @@
+package apictx
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVEscapeFormulas makes CSV prefix the cells that spreadsheet
+// applications would run as formulas, those starting with =, +, -, @, a
+// tab or a carriage return, with a single quote. Numbers are written as
+// is. It guards exports of user data against formula injection and should
+// only be turned off for files that are not opened in spreadsheets.
+var CSVEscapeFormulas = true
+
+// CSV writes rows as a text/csv download saved under filename. Rows is
+// either a [][]string, written as is, or a slice of structs written with a
+// header row. Columns are named by the `csv` tags of the fields or else
+// their Go names, `csv:"-"` leaves a field out and the `layout` tag formats
+// time.Time fields. Rows are encoded one by one as they are sent.
+func (c *Context) CSV(code int, filename string, rows interface{}) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	table, err := newTable(rows, "csv")
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+
+	c.writer.Header().Set("Content-Type", "text/csv;charset=utf-8")
+	c.writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.writer.WriteHeader(statusCode)
+
+	w := csv.NewWriter(c.writer)
+	if table.header != nil {
+		w.Write(escapeFormulas(table.header))
+	}
+	for i := 0; i < table.len(); i++ {
+		if w.Write(escapeFormulas(table.row(i))) != nil {
+			return
+		}
+	}
+	w.Flush()
+}
+
+// escapeFormulas neutralizes the cells of row that would be run as
+// formulas, see CSVEscapeFormulas.
+func escapeFormulas(row []string) []string {
+	if !CSVEscapeFormulas {
+		return row
+	}
+	var escaped []string
+	for i, cell := range row {
+		if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+			continue
+		}
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			continue
+		}
+		if escaped == nil {
+			escaped = slices.Clone(row)
+		}
+		escaped[i] = "'" + cell
+	}
+	if escaped == nil {
+		return row
+	}
+	return escaped
+}
+
+// table reads the rows of a tabular export from a [][]string or a slice
+// of structs.
+type table struct {
+	rows    reflect.Value
+	strings [][]string
+	header  []string
+	columns []column
+}
+
+// column is an exported struct field, index is its path through embedded
+// structs.
+type column struct {
+	index  []int
+	layout string
+	opts   tagOptions
+}
+
+func newTable(rows interface{}, tagName string) (*table, error) {
+	if s, ok := rows.([][]string); ok {
+		return &table{strings: s}, nil
+	}
+	val := reflect.ValueOf(rows)
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil, fmt.Errorf("cannot export %T, want a slice of structs or [][]string", rows)
+	}
+	typ := val.Type().Elem()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot export %T, want a slice of structs or [][]string", rows)
+	}
+	t := &table{rows: val}
+	t.addColumns(typ, tagName, nil)
+	return t, nil
+}
+
+func (t *table) addColumns(typ reflect.Type, tagName string, index []int) {
+	for _, cf := range cachedFields(typ, tagName) {
+		sf := typ.Field(cf.index)
+		if cf.name == "-" {
+			continue
+		}
+		path := append(append([]int(nil), index...), cf.index)
+		if cf.embedded && cf.name == "" {
+			ft := sf.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				t.addColumns(ft, tagName, path)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name := cf.name
+		if name == "" {
+			name = cf.fieldName
+		}
+		t.header = append(t.header, name)
+		t.columns = append(t.columns, column{index: path, layout: cf.layout, opts: cf.opts})
+	}
+}
+
+func (t *table) len() int {
+	if t.strings != nil {
+		return len(t.strings)
+	}
+	return t.rows.Len()
+}
+
+func (t *table) row(i int) []string {
+	if t.strings != nil {
+		return t.strings[i]
+	}
+	out := make([]string, len(t.columns))
+	for j, field := range t.values(i) {
+		if field.IsValid() {
+			out[j] = formatValue(field, t.columns[j])
+		}
+	}
+	return out
+}
+
+// values returns the fields of the struct row i, invalid for fields behind
+// nil embedded pointers.
+func (t *table) values(i int) []reflect.Value {
+	elem := t.rows.Index(i)
+	out := make([]reflect.Value, len(t.columns))
+	for j, col := range t.columns {
+		out[j], _ = fieldByIndex(elem, col.index)
+	}
+	return out
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex stopping at nil pointers.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, i := range index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, true
+}
+
+// formatValue formats v, a field of col, as text, the reverse of setValue.
+// Nil pointers are empty, time.Time uses the layout of col, RFC 3339 by
+// default, durations are written like "1m30s" and []byte as base64.
+func formatValue(v reflect.Value, col column) string {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if v.CanInterface() {
+		if t, ok := v.Interface().(time.Time); ok {
+			layout := col.layout
+			if layout == "" {
+				layout = time.RFC3339
+			}
+			return t.Format(layout)
+		}
+		if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			if err == nil {
+				return string(b)
+			}
+		}
+	}
+	if isDuration(v.Type()) {
+		return time.Duration(v.Int()).String()
+	}
+	if isBytes(v.Type()) {
+		enc := base64.RawStdEncoding
+		if col.opts.Has("base64url") {
+			enc = base64.RawURLEncoding
+		}
+		return enc.EncodeToString(v.Bytes())
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits())
+	}
+	return fmt.Sprint(v)
+}
+
+// Sheet is a worksheet of an XLSX export. Rows is a [][]string or a slice
+// of structs, like the rows of CSV.
+type Sheet struct {
+	Name string
+	Rows interface{}
+}
+
+// XLSX writes sheets as an Excel workbook download saved under filename.
+// Columns of struct rows are named by their `xlsx` tags, or else their Go
+// names, and `xlsx:"-"` leaves a field out. Numbers and booleans are
+// written as such, other values, NaN and infinities as text. Sheet names
+// are made valid and unique. The workbook is encoded while it is sent.
+func (c *Context) XLSX(code int, filename string, sheets ...Sheet) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	tables := make([]*table, len(sheets))
+	for i, sheet := range sheets {
+		t, err := newTable(sheet.Rows, "xlsx")
+		if err != nil {
+			c.handleError(err)
+			return
+		}
+		tables[i] = t
+	}
+
+	c.writer.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.writer.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.writer.WriteHeader(statusCode)
+
+	zw := zip.NewWriter(c.writer)
+	err := writeWorkbook(zw, sheets, tables)
+	if err != nil {
+		return
+	}
+	zw.Close()
+}
+
+const (
+	xmlProlog   = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	nsMain      = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRels      = "http://schemas.openxmlformats.org/package/2006/relationships"
+	nsDocRels   = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	ctWorksheet = "application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"
+)
+
+// writeWorkbook writes the parts of a minimal SpreadsheetML package.
+func writeWorkbook(zw *zip.Writer, sheets []Sheet, tables []*table) error {
+	var types, workbook, rels strings.Builder
+	types.WriteString(xmlProlog + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xmlProlog + `<workbook xmlns="` + nsMain + `" xmlns:r="` + nsDocRels + `"><sheets>`)
+	rels.WriteString(xmlProlog + `<Relationships xmlns="` + nsRels + `">`)
+	for i, name := range sheetNames(sheets) {
+		n := i + 1
+		fmt.Fprintf(&types, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="%s"/>`, n, ctWorksheet)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, n, nsDocRels, n)
+	}
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", types.String()},
+		{"_rels/.rels", xmlProlog + `<Relationships xmlns="` + nsRels + `"><Relationship Id="rId1" Type="` + nsDocRels + `/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", rels.String()},
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, t := range tables {
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		err = writeSheet(w, t)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSheet writes the worksheet of t row by row.
+func writeSheet(w io.Writer, t *table) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(xmlProlog + `<worksheet xmlns="` + nsMain + `"><sheetData>`)
+	r := 0
+	if t.header != nil {
+		r++
+		writeRow(bw, r, len(t.header), func(j int) (string, bool) { return t.header[j], false })
+	}
+	for i := 0; i < t.len(); i++ {
+		r++
+		if t.strings != nil {
+			row := t.strings[i]
+			writeRow(bw, r, len(row), func(j int) (string, bool) { return row[j], false })
+			continue
+		}
+		values := t.values(i)
+		writeRow(bw, r, len(values), func(j int) (string, bool) {
+			v := values[j]
+			if !v.IsValid() {
+				return "", false
+			}
+			for v.Kind() == reflect.Pointer && !v.IsNil() {
+				v = v.Elem()
+			}
+			numeric := (isNumber(v.Kind()) && !isDuration(v.Type())) || v.Kind() == reflect.Bool
+			if k := v.Kind(); (k == reflect.Float32 || k == reflect.Float64) && (math.IsNaN(v.Float()) || math.IsInf(v.Float(), 0)) {
+				numeric = false // SpreadsheetML numbers have no NaN or infinity
+			}
+			return formatValue(v, t.columns[j]), numeric && !v.Type().Implements(textMarshalerType)
+		})
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	bw.WriteString(`</sheetData></worksheet>`)
+	return bw.Flush()
+}
+
+// writeRow writes row r of n cells, cell returns the text of a cell and
+// whether it is a number or boolean rather than a string.
+func writeRow(w *bufio.Writer, r, n int, cell func(j int) (string, bool)) {
+	fmt.Fprintf(w, `<row r="%d">`, r)
+	for j := 0; j < n; j++ {
+		text, typed := cell(j)
+		ref := columnName(j) + strconv.Itoa(r)
+		switch {
+		case text == "":
+			continue
+		case typed && (text == "true" || text == "false"):
+			b := "0"
+			if text == "true" {
+				b = "1"
+			}
+			fmt.Fprintf(w, `<c r="%s" t="b"><v>%s</v></c>`, ref, b)
+		case typed:
+			fmt.Fprintf(w, `<c r="%s"><v>%s</v></c>`, ref, text)
+		default:
+			fmt.Fprintf(w, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(text))
+		}
+	}
+	w.WriteString(`</row>`)
+}
+
+// columnName returns the letters of column j, counted from 0: A, B, ...,
+// Z, AA, AB and so on.
+func columnName(j int) string {
+	name := ""
+	for j++; j > 0; j = (j - 1) / 26 {
+		name = string(rune('A'+(j-1)%26)) + name
+	}
+	return name
+}
+
+// sheetName makes name a valid worksheet name, at most 31 characters
+// without any of []:*?/\. Empty names become "Sheet" followed by n.
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+	if name == "" {
+		name = "Sheet" + strconv.Itoa(n)
+	}
+	return name
+}
+
+// sheetNames returns the worksheet names of sheets, see sheetName. Names
+// Excel would take for the same, as it ignores case, get a suffix such as
+// " (2)", since a workbook with duplicate names is rejected as corrupt.
+func sheetNames(sheets []Sheet) []string {
+	names := make([]string, len(sheets))
+	used := map[string]bool{}
+	for i, sheet := range sheets {
+		base := sheetName(sheet.Name, i+1)
+		name := base
+		for k := 2; used[strings.ToLower(name)]; k++ {
+			suffix := " (" + strconv.Itoa(k) + ")"
+			runes := []rune(base)
+			name = string(runes[:min(len(runes), 31-len(suffix))]) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
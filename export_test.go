@@ -0,0 +1,138 @@
+package apictx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type exportRow struct {
+	Name  string  `xlsx:"name"`
+	Score float64 `xlsx:"score"`
+	OK    bool    `xlsx:"ok"`
+}
+
+// readWorkbook unzips an XLSX download, checking that every part is well
+// formed XML.
+func readWorkbook(t *testing.T, body []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		dec := xml.NewDecoder(bytes.NewReader(b))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestXLSX(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := NewContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	c.XLSX(0, "report.xlsx",
+		Sheet{Name: "S", Rows: []exportRow{{"a & b", 1.5, true}, {"<nan>", math.NaN(), false}, {"inf", math.Inf(-1), false}}},
+		Sheet{Name: "s", Rows: [][]string{{"x"}}},
+		Sheet{Name: "S", Rows: [][]string{}},
+		Sheet{Name: strings.Repeat("n", 40), Rows: [][]string{}},
+		Sheet{Name: strings.Repeat("n", 40), Rows: [][]string{}},
+		Sheet{Rows: [][]string{}},
+	)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	parts := readWorkbook(t, w.Body.Bytes())
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal([]byte(parts["xl/workbook.xml"]), &workbook); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, s := range workbook.Sheets {
+		names = append(names, s.Name)
+	}
+	want := []string{"S", "s (2)", "S (3)", strings.Repeat("n", 31), strings.Repeat("n", 27) + " (2)", "Sheet6"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got sheets %q, want %q", names, want)
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, cell := range []string{
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">a &amp; b</t></is></c>`,
+		`<c r="B2"><v>1.5</v></c>`,
+		`<c r="C2" t="b"><v>1</v></c>`,
+		`<c r="B3" t="inlineStr"><is><t xml:space="preserve">NaN</t></is></c>`,
+		`<c r="B4" t="inlineStr"><is><t xml:space="preserve">-Inf</t></is></c>`,
+	} {
+		if !strings.Contains(sheet, cell) {
+			t.Errorf("missing %s in %s", cell, sheet)
+		}
+	}
+}
+
+func TestCSVFormatsLikeBinding(t *testing.T) {
+	type row struct {
+		Timeout time.Duration `csv:"timeout"`
+		TTL     Duration      `csv:"ttl"`
+		Data    []byte        `csv:"data"`
+		Sig     []byte        `csv:"sig,base64url"`
+		Since   time.Time     `csv:"since" layout:"2006-01-02"`
+		Tags    *string       `csv:"tags"`
+	}
+	in := row{90 * time.Second, Duration(time.Minute), []byte("hi?>"), []byte("hi?>"), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), nil}
+	w := httptest.NewRecorder()
+	c := NewContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	c.CSV(0, "rows.csv", []row{in})
+
+	want := "timeout,ttl,data,sig,since,tags\n1m30s,1m0s,aGk/Pg,aGk_Pg,2024-01-02,\n"
+	if got := w.Body.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// the cells bind back to the same values
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	query := make([]string, 0, 5)
+	for i, name := range strings.Split(lines[0], ",")[:5] {
+		query = append(query, name+"="+strings.Split(lines[1], ",")[i])
+	}
+	var out struct {
+		Timeout time.Duration `query:"timeout"`
+		TTL     Duration      `query:"ttl"`
+		Data    []byte        `query:"data"`
+		Sig     []byte        `query:"sig,base64url"`
+		Since   time.Time     `query:"since" layout:"2006-01-02"`
+	}
+	r := httptest.NewRequest(http.MethodGet, "/?"+strings.ReplaceAll(strings.Join(query, "&"), "/", "%2F"), nil)
+	if err := newTestContext(r).BindQuery(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Timeout != in.Timeout || out.TTL != in.TTL || string(out.Data) != string(in.Data) || string(out.Sig) != string(in.Sig) || !out.Since.Equal(in.Since) {
+		t.Errorf("got %+v, want %+v", out, in)
+	}
+}
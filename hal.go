@@ -0,0 +1,92 @@
+package apictx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// HAL is a resource in the HAL format (application/hal+json): the fields
+// of the resource together with its _links and _embedded resources.
+type HAL struct {
+	Resource interface{}
+	Links    Links
+	Embedded map[string]interface{}
+}
+
+// NewHAL returns a HAL representation of resource, a struct or map
+// encoded as a JSON object.
+func NewHAL(resource interface{}) *HAL {
+	return &HAL{Resource: resource, Links: Links{}}
+}
+
+// Link sets the link of relation rel and returns h.
+func (h *HAL) Link(rel, href string) *HAL {
+	if h.Links == nil {
+		h.Links = Links{}
+	}
+	h.Links.Add(rel, href)
+	return h
+}
+
+// Embed sets the embedded resources of relation rel, a *HAL or a slice of
+// them, and returns h.
+func (h *HAL) Embed(rel string, resources interface{}) *HAL {
+	if h.Embedded == nil {
+		h.Embedded = map[string]interface{}{}
+	}
+	h.Embedded[rel] = resources
+	return h
+}
+
+// MarshalJSON encodes the resource with the _links and _embedded members
+// added to its fields.
+func (h HAL) MarshalJSON() ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if h.Resource != nil {
+		b, err := json.Marshal(h.Resource)
+		if err != nil {
+			return nil, err
+		}
+		if string(b) != "null" {
+			err = json.Unmarshal(b, &fields)
+			if err != nil {
+				return nil, fmt.Errorf("HAL resource %T is not a JSON object", h.Resource)
+			}
+		}
+	}
+	if len(h.Links) > 0 {
+		b, err := json.Marshal(h.Links)
+		if err != nil {
+			return nil, err
+		}
+		fields["_links"] = b
+	}
+	if len(h.Embedded) > 0 {
+		b, err := json.Marshal(h.Embedded)
+		if err != nil {
+			return nil, err
+		}
+		fields["_embedded"] = b
+	}
+	return json.Marshal(fields)
+}
+
+// HAL writes h as an application/hal+json response.
+func (c *Context) HAL(code int, h *HAL) {
+	statusCode, data := c.intercept(code, h)
+	b, err := jsonCodec.Marshal(data)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	c.writer.Header().Set("Content-Type", "application/hal+json")
+	c.writer.WriteHeader(statusCode)
+	c.writer.Write(append(b, '\n'))
+}
+
+func init() {
+	RegisterEncoder("application/hal+json", func(w io.Writer, data interface{}) error {
+		return jsonCodec.NewEncoder(w).Encode(data)
+	})
+}
@@ -0,0 +1,30 @@
+package apictx
+
+import "net/http"
+
+// Interceptor runs before a response payload is written and returns the
+// status code and payload to write instead, e.g. to wrap payloads in an
+// envelope, set headers through c.Writer() or redact fields.
+type Interceptor func(c *Context, code int, payload interface{}) (int, interface{})
+
+var interceptors []Interceptor
+
+// RegisterInterceptor adds fn to the interceptors run, in order of
+// registration, by JSON, JSONIndent, JSONP, XML, MsgPack, CBOR, HAL,
+// Negotiate and JSONWithETag. It is not safe for concurrent use and
+// should be called during initialization.
+func RegisterInterceptor(fn Interceptor) {
+	interceptors = append(interceptors, fn)
+}
+
+// intercept resolves the zero status code to 200 OK and runs the
+// interceptors on the response.
+func (c *Context) intercept(code int, data interface{}) (int, interface{}) {
+	if code == 0 {
+		code = http.StatusOK
+	}
+	for _, fn := range interceptors {
+		code, data = fn(c, code, data)
+	}
+	return code, data
+}
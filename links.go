@@ -0,0 +1,90 @@
+package apictx
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// TrustProxyHeaders makes the URLs built from a request use the scheme and
+// host of the Forwarded and X-Forwarded-* headers, for services behind a
+// reverse proxy. Only enable it when the proxy sets these headers, clients
+// could forge them otherwise.
+var TrustProxyHeaders bool
+
+// Link is a hypermedia link.
+type Link struct {
+	Href string `json:"href"`
+}
+
+// Links are the hypermedia links of a resource keyed by their relation,
+// to be embedded in response payloads:
+//
+//	type UserResponse struct {
+//		User
+//		Links apictx.Links `json:"_links"`
+//	}
+type Links map[string]Link
+
+// Add sets the link of relation rel and returns l.
+func (l Links) Add(rel, href string) Links {
+	l[rel] = Link{Href: href}
+	return l
+}
+
+// Links returns links holding the self link of the request.
+func (c *Context) Links() Links {
+	return Links{"self": {Href: requestURL(c.request).String()}}
+}
+
+// URL returns the absolute URL of ref, a path or URL resolved against the
+// URL of the request, e.g. c.URL("/users/42").
+func (c *Context) URL(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return requestURL(c.request).ResolveReference(u).String()
+}
+
+// requestURL returns the absolute URL of r as seen by the client.
+func requestURL(r *http.Request) *url.URL {
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	if TrustProxyHeaders {
+		proto, host := forwardedHost(r)
+		if proto != "" {
+			u.Scheme = proto
+		}
+		if host != "" {
+			u.Host = host
+		}
+	}
+	return &u
+}
+
+// forwardedHost returns the scheme and host set by the closest proxy in
+// the Forwarded header, or else in X-Forwarded-Proto and X-Forwarded-Host.
+func forwardedHost(r *http.Request) (proto, host string) {
+	if fwd := r.Header.Get("Forwarded"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		for _, pair := range strings.Split(first, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			v = strings.Trim(v, `"`)
+			switch strings.ToLower(k) {
+			case "proto":
+				proto = strings.ToLower(v)
+			case "host":
+				host = v
+			}
+		}
+		return proto, host
+	}
+	proto, _, _ = strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	host, _, _ = strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	return strings.ToLower(strings.TrimSpace(proto)), strings.TrimSpace(host)
+}
@@ -0,0 +1,136 @@
+package apictx
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// modifiers are the string normalizations available to the `mod` tag.
+var modifiers = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"ltrim": func(s string) string { return strings.TrimLeft(s, " \t\r\n") },
+	"rtrim": func(s string) string { return strings.TrimRight(s, " \t\r\n") },
+	"lcase": strings.ToLower,
+	"ucase": strings.ToUpper,
+}
+
+var modifierChecks sync.Map // reflect.Type -> error, nil when valid
+
+// checkModifiers reports an unknown modifier in the `mod` tags of typ or
+// of the structs its fields hold. Types are checked once, so a typo fails
+// every request rather than only those setting the field.
+func checkModifiers(typ reflect.Type) error {
+	if err, ok := modifierChecks.Load(typ); ok {
+		err, _ := err.(error)
+		return err
+	}
+	err := findUnknownModifier(typ, map[reflect.Type]bool{})
+	modifierChecks.Store(typ, err)
+	return err
+}
+
+func findUnknownModifier(typ reflect.Type, seen map[reflect.Type]bool) error {
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return nil
+	}
+	seen[typ] = true
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		if tag := sf.Tag.Get("mod"); tag != "" {
+			for _, mod := range strings.Split(tag, ",") {
+				if _, ok := modifiers[strings.TrimSpace(mod)]; !ok {
+					return fmt.Errorf("unknown modifier %q on field %s of %s", mod, sf.Name, typ)
+				}
+			}
+			continue
+		}
+		err := findUnknownModifier(sf.Type, seen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyModifiers normalizes the string fields of val, including those of
+// nested structs and slices, that have a `mod` tag such as `mod:"trim,lcase"`.
+// Modifiers are applied in the order they are listed.
+func applyModifiers(val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !val.IsNil() {
+			return applyModifiers(val.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		if val.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < val.Len(); i++ {
+			err := applyModifiers(val.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		typ := val.Type()
+		for i := 0; i < val.NumField(); i++ {
+			sf := typ.Field(i)
+			if !sf.IsExported() && !sf.Anonymous {
+				continue
+			}
+			field := val.Field(i)
+			if tag := sf.Tag.Get("mod"); tag != "" {
+				err := modifyStrings(field, strings.Split(tag, ","), sf.Name)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			err := applyModifiers(field)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// modifyStrings applies mods to a string field, or to the strings a pointer
+// or slice field holds.
+func modifyStrings(field reflect.Value, mods []string, name string) error {
+	switch field.Kind() {
+	case reflect.String:
+		if !field.CanSet() {
+			return nil
+		}
+		s := field.String()
+		for _, mod := range mods {
+			fn, ok := modifiers[strings.TrimSpace(mod)]
+			if !ok {
+				return fmt.Errorf("unknown modifier %q on field %s", mod, name)
+			}
+			s = fn(s)
+		}
+		field.SetString(s)
+	case reflect.Pointer:
+		if !field.IsNil() {
+			return modifyStrings(field.Elem(), mods, name)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < field.Len(); i++ {
+			err := modifyStrings(field.Index(i), mods, name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
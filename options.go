@@ -0,0 +1,147 @@
+package apictx
+
+// BindSource is a part of the request Bind reads values from.
+type BindSource string
+
+const (
+	SourceQuery  BindSource = "query"
+	SourcePath   BindSource = "path"
+	SourceHeader BindSource = "header"
+	SourceCookie BindSource = "cookie"
+	SourceBody   BindSource = "body"
+)
+
+// DefaultPrecedence is the order in which Bind prefers the request sources
+// when a field is set by more than one of them, highest first.
+var DefaultPrecedence = []BindSource{SourceBody, SourceCookie, SourceHeader, SourcePath, SourceQuery}
+
+// BindPrecedencer is implemented by bind targets that prefer the request
+// sources in a different order than DefaultPrecedence.
+type BindPrecedencer interface {
+	BindPrecedence() []BindSource
+}
+
+// BindOptions control how Bind reads a request.
+type BindOptions struct {
+	// DisallowUnknownFields rejects JSON bodies containing fields that do
+	// not match the bound struct instead of silently dropping them.
+	DisallowUnknownFields bool
+
+	// MaxBodyBytes limits the size of the request body, larger bodies are
+	// rejected with 413 Request Entity Too Large. Zero means no limit.
+	MaxBodyBytes int64
+
+	// MaxDecompressedBytes limits the size of a gzip or deflate encoded
+	// body after decompression. Zero means no limit.
+	MaxDecompressedBytes int64
+
+	// CaseInsensitiveQuery matches query parameters to `query` tags
+	// regardless of case, so ?PageSize=10 binds `query:"pagesize"`.
+	CaseInsensitiveQuery bool
+
+	// Precedence is the order in which the request sources are preferred
+	// when a field is set by more than one of them, highest first. Sources
+	// missing from the list are not bound. Nil means DefaultPrecedence.
+	Precedence []BindSource
+
+	// ValidationGroup is the scenario the request is validated for, such
+	// as "create" or "update". Fields with a `groups` tag are only
+	// validated when it lists the group. Empty validates every field.
+	ValidationGroup string
+
+	// SkipValidation leaves validation to the handler, Bind only decodes
+	// the request.
+	SkipValidation bool
+
+	// PartialFields limits validation to the listed fields, named by their
+	// Go names such as "Email" or "Address.City". It is applied by the
+	// built-in validator only.
+	PartialFields []string
+
+	// explicitPrecedence is set when Precedence comes from the options of
+	// the call, which take priority over BindPrecedencer.
+	explicitPrecedence bool
+}
+
+// BindOption changes the BindOptions of a single Bind call.
+type BindOption func(*BindOptions)
+
+// DefaultBindOptions are the options every Bind call starts from. Bodies
+// are limited to 32 MiB, before and after decompression.
+var DefaultBindOptions = BindOptions{
+	MaxBodyBytes:         32 << 20,
+	MaxDecompressedBytes: 32 << 20,
+}
+
+func newBindOptions(opts []BindOption) BindOptions {
+	o := DefaultBindOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// StrictJSON rejects JSON bodies with unknown fields.
+func StrictJSON() BindOption {
+	return func(o *BindOptions) {
+		o.DisallowUnknownFields = true
+	}
+}
+
+// MaxBodyBytes limits the request body to n bytes.
+func MaxBodyBytes(n int64) BindOption {
+	return func(o *BindOptions) {
+		o.MaxBodyBytes = n
+	}
+}
+
+// CaseInsensitiveQuery matches query parameter names regardless of case.
+func CaseInsensitiveQuery() BindOption {
+	return func(o *BindOptions) {
+		o.CaseInsensitiveQuery = true
+	}
+}
+
+// Precedence overrides the order in which the request sources are preferred
+// for a single call, highest first. Sources not listed are not bound.
+func Precedence(sources ...BindSource) BindOption {
+	return func(o *BindOptions) {
+		o.Precedence = sources
+		o.explicitPrecedence = true
+	}
+}
+
+// ValidationGroup validates the request for a single scenario, skipping
+// the rules of fields whose `groups` tag does not list it.
+func ValidationGroup(name string) BindOption {
+	return func(o *BindOptions) {
+		o.ValidationGroup = name
+	}
+}
+
+// SkipValidation binds the request without validating it.
+func SkipValidation() BindOption {
+	return func(o *BindOptions) {
+		o.SkipValidation = true
+	}
+}
+
+// WithPartial only validates the given fields, named by their Go names.
+func WithPartial(fields ...string) BindOption {
+	return func(o *BindOptions) {
+		o.PartialFields = fields
+	}
+}
+
+func (o BindOptions) precedenceFor(data interface{}) []BindSource {
+	if o.explicitPrecedence {
+		return o.Precedence
+	}
+	if p, ok := data.(BindPrecedencer); ok {
+		return p.BindPrecedence()
+	}
+	if o.Precedence != nil {
+		return o.Precedence
+	}
+	return DefaultPrecedence
+}
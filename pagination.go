@@ -0,0 +1,79 @@
+package apictx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageParam and PerPageParam are the query parameters of the page links
+// written by Paginated.
+var (
+	PageParam    = "page"
+	PerPageParam = "per_page"
+)
+
+// Page is a page of a paginated collection, the shape of the responses
+// written by Paginated.
+type Page[T any] struct {
+	Items []T      `json:"items"`
+	Meta  PageMeta `json:"meta"`
+}
+
+// PageMeta describes the position of a Page in its collection. Next and
+// Prev are the URLs of the neighbouring pages, empty at either end.
+type PageMeta struct {
+	Total      int    `json:"total"`
+	Page       int    `json:"page"`
+	PerPage    int    `json:"per_page"`
+	TotalPages int    `json:"total_pages"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+}
+
+// Paginated writes items, the 1-based page of a collection of total items
+// split into pages of perPage, as a JSON Page. The first, last, next and
+// prev pages are linked in an RFC 8288 Link header, keeping the other
+// query parameters of the request.
+//
+//	apictx.Paginated(ctx, http.StatusOK, users, total, page, perPage)
+func Paginated[T any](c *Context, code int, items []T, total, page, perPage int) {
+	if perPage <= 0 {
+		perPage = total
+	}
+	totalPages := 1
+	if perPage > 0 {
+		totalPages = (total + perPage - 1) / perPage
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	meta := PageMeta{Total: total, Page: page, PerPage: perPage, TotalPages: totalPages}
+	links := []string{
+		fmt.Sprintf(`<%s>; rel="first"`, c.pageURL(1, perPage)),
+		fmt.Sprintf(`<%s>; rel="last"`, c.pageURL(max(totalPages, 1), perPage)),
+	}
+	if page < totalPages {
+		meta.Next = c.pageURL(page+1, perPage)
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, meta.Next))
+	}
+	if page > 1 {
+		meta.Prev = c.pageURL(min(page-1, max(totalPages, 1)), perPage)
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, meta.Prev))
+	}
+	c.writer.Header().Add("Link", strings.Join(links, ", "))
+	c.writer.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	c.JSON(code, Page[T]{Items: items, Meta: meta})
+}
+
+// pageURL returns the URL of the request with its page parameters set.
+func (c *Context) pageURL(page, perPage int) string {
+	u := requestURL(c.request)
+	q := u.Query()
+	q.Set(PageParam, strconv.Itoa(page))
+	q.Set(PerPageParam, strconv.Itoa(perPage))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -0,0 +1,107 @@
+package apictx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+)
+
+// Renderer renders the named template with data, used by Context.Render.
+type Renderer interface {
+	Render(w io.Writer, name string, data interface{}) error
+}
+
+// renderer is the Renderer of Context.Render, set with SetRenderer.
+var renderer Renderer
+
+// SetRenderer sets the Renderer used by Context.Render. It is not safe for
+// concurrent use and should be called during initialization.
+func SetRenderer(r Renderer) {
+	renderer = r
+}
+
+// Render writes the template name rendered with data as a text/html
+// response. The page is rendered before anything is written, so failures
+// are answered through HandleError.
+func (c *Context) Render(code int, name string, data interface{}) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	if renderer == nil {
+		c.handleError(errors.New("no renderer set, see apictx.SetRenderer"))
+		return
+	}
+	var buf bytes.Buffer
+	err := renderer.Render(&buf, name, data)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	c.writer.Header().Set("Content-Type", "text/html;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	c.writer.Write(buf.Bytes())
+}
+
+// TemplateRenderer is a Renderer of html/template pages sharing a layout
+// and partials. Pages are named by their file name, e.g. "users.html".
+type TemplateRenderer struct {
+	layout string
+	pages  map[string]*template.Template
+}
+
+// NewTemplateRenderer parses the pages of fsys matching the pattern pages.
+// Each page is parsed together with the layout file and the partials
+// matching the patterns partials, so it can fill in the blocks of the
+// layout and call the partials. Rendering a page executes the layout, or
+// the page itself when layout is empty.
+func NewTemplateRenderer(fsys fs.FS, layout, pages string, partials ...string) (*TemplateRenderer, error) {
+	files, err := fs.Glob(fsys, pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no templates match %q", pages)
+	}
+
+	r := &TemplateRenderer{pages: make(map[string]*template.Template, len(files))}
+	var shared []string
+	if layout != "" {
+		r.layout = path.Base(layout)
+		shared = append(shared, layout)
+	}
+	for _, pattern := range partials {
+		matches, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		shared = append(shared, matches...)
+	}
+
+	for _, file := range files {
+		name := path.Base(file)
+		t, err := template.New(name).ParseFS(fsys, append(shared, file)...)
+		if err != nil {
+			return nil, err
+		}
+		r.pages[name] = t
+	}
+	return r, nil
+}
+
+// Render executes the page name with data.
+func (r *TemplateRenderer) Render(w io.Writer, name string, data interface{}) error {
+	t, ok := r.pages[name]
+	if !ok {
+		return fmt.Errorf("template %q not found", name)
+	}
+	if r.layout != "" {
+		return t.ExecuteTemplate(w, r.layout, data)
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
@@ -0,0 +1,67 @@
+package apictx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the ID of a request, read from
+// requests and echoed in responses.
+var RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+
+// withRequestID returns r carrying its request ID, generating one when
+// the request has none or an invalid one, and echoes the ID in the
+// response header.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if _, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return r
+	}
+	id := r.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// RequestID returns the ID of r, as taken from its RequestIDHeader or
+// generated by Handler, or "" outside of Handler without a valid header.
+func RequestID(r *http.Request) string {
+	if id, ok := r.Context().Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+	return ""
+}
+
+// RequestID returns the ID of the request, see the RequestID function.
+func (c *Context) RequestID() string {
+	return RequestID(c.request)
+}
+
+// validRequestID reports whether a request ID sent by the client may be
+// used. It ends up in headers, logs and error bodies, so only IDs of at
+// most 128 letters, digits, dots, underscores and hyphens are accepted.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,51 @@
+package apictx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"absent", "", false},
+		{"uuid", "7f9c2a1e-3b4d-4c5e-8f60-1a2b3c4d5e6f", true},
+		{"dotted", "trace_1.span-2", true},
+		{"longest", strings.Repeat("a", 128), true},
+		{"too long", strings.Repeat("a", 129), false},
+		{"spaces", "a b", false},
+		{"log injection", "a\nlevel=ERROR", false},
+		{"markup", "<script>", false},
+		{"quotes", `a"b`, false},
+		{"non-ascii", "ä", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header[RequestIDHeader] = []string{tt.header}
+			}
+			var got string
+			w := httptest.NewRecorder()
+			Handler(func(c *Context) error {
+				got = c.RequestID()
+				return nil
+			}).ServeHTTP(w, r)
+
+			if kept := got == tt.header; kept != tt.kept {
+				t.Errorf("got ID %q for header %q", got, tt.header)
+			}
+			if !validRequestID(got) || w.Header().Get(RequestIDHeader) != got {
+				t.Errorf("got ID %q, echoed %q", got, w.Header().Get(RequestIDHeader))
+			}
+			if RequestID(r) != "" && !tt.kept {
+				t.Errorf("RequestID outside of Handler returned %q", RequestID(r))
+			}
+		})
+	}
+}
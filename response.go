@@ -0,0 +1,232 @@
+package apictx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// PrettyJSONParam names a query parameter that makes JSON indent its
+// output when set to a true value, e.g. "pretty" for ?pretty=1. Empty
+// disables it.
+var PrettyJSONParam string
+
+func (c *Context) JSON(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	var pretty bool
+	if PrettyJSONParam != "" {
+		pretty, _ = strconv.ParseBool(c.request.URL.Query().Get(PrettyJSONParam))
+	}
+	c.writeJSON(statusCode, data, pretty)
+}
+
+// JSONIndent writes data as indented JSON, for responses read by people.
+func (c *Context) JSONIndent(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	c.writeJSON(statusCode, data, true)
+}
+
+func (c *Context) writeJSON(statusCode int, data interface{}, indent bool) {
+	c.writer.Header().Set("Content-Type", "application/json;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	enc := jsonCodec.NewEncoder(c.writer)
+	if indent {
+		enc.SetIndent("", "  ")
+	}
+	enc.Encode(data)
+}
+
+// jsonpCallback matches the callback names JSONP accepts, JavaScript
+// identifiers optionally separated by dots.
+var jsonpCallback = regexp.MustCompile(`^[a-zA-Z_$][0-9a-zA-Z_$]*(\.[a-zA-Z_$][0-9a-zA-Z_$]*)*$`)
+
+// JSONP writes data as a JavaScript call of callback, for legacy clients
+// loading responses with script tags. Callbacks that are not plain
+// JavaScript names are rejected with 400 Bad Request.
+func (c *Context) JSONP(code int, callback string, data interface{}) {
+	if len(callback) > 128 || !jsonpCallback.MatchString(callback) {
+		c.handleError(NewHttpError("invalid JSONP callback", nil, http.StatusBadRequest))
+		return
+	}
+	statusCode, data := c.intercept(code, data)
+	b, err := jsonCodec.Marshal(data)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	c.writer.Header().Set("Content-Type", "application/javascript;charset=utf-8")
+	c.writer.Header().Set("X-Content-Type-Options", "nosniff")
+	c.writer.WriteHeader(statusCode)
+	// the comment keeps the body from being read as a Flash file
+	fmt.Fprintf(c.writer, "/**/ typeof %s === 'function' && %s(%s);", callback, callback, b)
+}
+
+// Envelope is the uniform shape of responses written by OK, and of error
+// responses when EnvelopeErrors is set.
+type Envelope struct {
+	Data  interface{}       `json:"data"`
+	Meta  interface{}       `json:"meta"`
+	Error *ApiErrorResponse `json:"error"`
+}
+
+// EnvelopeErrors makes HandleError wrap error responses in an Envelope,
+// matching the responses of OK.
+var EnvelopeErrors bool
+
+// OK writes data wrapped in an Envelope as a 200 JSON response, together
+// with meta when given.
+func (c *Context) OK(data interface{}, meta ...interface{}) {
+	env := Envelope{Data: data}
+	if len(meta) > 0 {
+		env.Meta = meta[0]
+	}
+	c.JSON(http.StatusOK, env)
+}
+
+// XML writes data as an application/xml response, preceded by the XML
+// declaration.
+func (c *Context) XML(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	c.writer.Header().Set("Content-Type", "application/xml;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	io.WriteString(c.writer, xml.Header)
+	xml.NewEncoder(c.writer).Encode(data)
+}
+
+// String writes a text/plain response. Without args, format is written as
+// is.
+func (c *Context) String(code int, format string, args ...interface{}) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	c.writer.Header().Set("Content-Type", "text/plain;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	if len(args) > 0 {
+		fmt.Fprintf(c.writer, format, args...)
+		return
+	}
+	io.WriteString(c.writer, format)
+}
+
+// HTML writes html as a text/html response.
+func (c *Context) HTML(code int, html string) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	c.writer.Header().Set("Content-Type", "text/html;charset=utf-8")
+	c.writer.WriteHeader(statusCode)
+	io.WriteString(c.writer, html)
+}
+
+// Stream copies r to the response, flushing after every chunk so large
+// objects reach the client without being buffered. Copying stops when the
+// client disconnects. Errors happen after the response has started, they
+// are returned for logging rather than to be answered.
+func (c *Context) Stream(code int, contentType string, r io.Reader) error {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	c.writer.Header().Set("Content-Type", contentType)
+	c.writer.WriteHeader(statusCode)
+
+	ctx := c.request.Context()
+	rc := http.NewResponseController(c.writer)
+	buf := make([]byte, 32<<10)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := c.writer.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if ferr := rc.Flush(); ferr != nil && !errors.Is(ferr, http.ErrNotSupported) {
+				return ferr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// NoContent answers with 204 No Content and an empty body.
+func (c *Context) NoContent() {
+	c.writer.WriteHeader(http.StatusNoContent)
+}
+
+// Status answers with code and an empty body.
+func (c *Context) Status(code int) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	c.writer.WriteHeader(statusCode)
+}
+
+// Redirect answers with a redirect to url, which may be relative to the
+// request path. Code must be a redirect status, 300 to 303, 307 or 308,
+// zero means 302 Found.
+func (c *Context) Redirect(code int, url string) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusFound
+	}
+	switch statusCode {
+	case http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		c.handleError(fmt.Errorf("invalid redirect status code %d", statusCode))
+		return
+	}
+	http.Redirect(c.writer, c.request, url, statusCode)
+}
+
+// MsgPack writes data as a MessagePack response, encoded using its `json` tags.
+func (c *Context) MsgPack(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	c.writer.Header().Set("Content-Type", "application/msgpack")
+	c.writer.WriteHeader(statusCode)
+	enc := msgpack.NewEncoder(c.writer)
+	enc.SetCustomStructTag("json")
+	enc.Encode(data)
+}
+
+// CBOR writes data as an application/cbor response.
+func (c *Context) CBOR(code int, data interface{}) {
+	statusCode, data := c.intercept(code, data)
+	c.writer.Header().Set("Content-Type", "application/cbor")
+	c.writer.WriteHeader(statusCode)
+	cbor.NewEncoder(c.writer).Encode(data)
+}
+
+// Proto writes msg as an application/x-protobuf response.
+func (c *Context) Proto(code int, msg proto.Message) {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		c.handleError(err)
+		return
+	}
+	c.writer.Header().Set("Content-Type", "application/x-protobuf")
+	c.writer.WriteHeader(statusCode)
+	c.writer.Write(b)
+}
@@ -0,0 +1,93 @@
+package apictx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONPCallbacks(t *testing.T) {
+	tests := []struct {
+		callback string
+		valid    bool
+	}{
+		{"cb", true},
+		{"jQuery_123", true},
+		{"$.widgets.load", true},
+		{"", false},
+		{"1cb", false},
+		{"cb()", false},
+		{"alert(1);cb", false},
+		{"cb.", false},
+		{"a..b", false},
+		{"cb\n", false},
+		{"<script>", false},
+		{"cb[0]", false},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c := NewContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+		c.JSONP(http.StatusOK, tt.callback, map[string]int{"a": 1})
+		if valid := w.Code == http.StatusOK; valid != tt.valid {
+			t.Errorf("%q: got status %d, want valid %v", tt.callback, w.Code, tt.valid)
+		}
+		if tt.valid {
+			continue
+		}
+		var body ApiErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%q: %v in %s", tt.callback, err, w.Body)
+		} else if tt.callback != "" && strings.Contains(body.Message, tt.callback) {
+			t.Errorf("%q: rejected callback echoed in %s", tt.callback, w.Body)
+		}
+	}
+}
+
+func TestJSONPBody(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := NewContext(w, httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	c.JSONP(0, "cb", map[string]string{"html": "</script>\u2028"})
+
+	want := `/**/ typeof cb === 'function' && cb({"html":"\u003c/script\u003e\u2028"});`
+	if got := w.Body.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/javascript;charset=utf-8" {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("missing X-Content-Type-Options: nosniff")
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		code int
+		want int
+	}{
+		{0, http.StatusFound},
+		{http.StatusMultipleChoices, http.StatusMultipleChoices},
+		{http.StatusMovedPermanently, http.StatusMovedPermanently},
+		{http.StatusSeeOther, http.StatusSeeOther},
+		{http.StatusTemporaryRedirect, http.StatusTemporaryRedirect},
+		{http.StatusPermanentRedirect, http.StatusPermanentRedirect},
+		{http.StatusNotModified, http.StatusInternalServerError},
+		{http.StatusUseProxy, http.StatusInternalServerError},
+		{306, http.StatusInternalServerError},
+		{http.StatusOK, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c := NewContext(w, httptest.NewRequest(http.MethodGet, "/a/b", nil), nil)
+		c.Redirect(tt.code, "/x")
+		if w.Code != tt.want {
+			t.Errorf("%d: got status %d, want %d", tt.code, w.Code, tt.want)
+		}
+		if loc := w.Header().Get("Location"); (loc == "/x") != (tt.want < 400) {
+			t.Errorf("%d: got Location %q", tt.code, loc)
+		}
+	}
+}
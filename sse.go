@@ -0,0 +1,142 @@
+package apictx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSEHeartbeat is the interval of the comments an EventStream sends to
+// keep idle connections open. Zero disables them.
+var SSEHeartbeat = 15 * time.Second
+
+// ErrStreamClosed is returned by EventStream.Send once the client has
+// disconnected or the stream was closed.
+var ErrStreamClosed = errors.New("event stream closed")
+
+// EventStream writes Server-Sent Events, created by Context.SSE.
+type EventStream struct {
+	mu     sync.Mutex
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	ctx    context.Context
+	closed bool
+	stop   chan struct{}
+}
+
+// SSE starts a text/event-stream response. The stream ends when the client
+// disconnects or Close is called, which handlers should defer:
+//
+//	stream := ctx.SSE()
+//	defer stream.Close()
+func (c *Context) SSE() *EventStream {
+	h := c.writer.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	c.writer.WriteHeader(http.StatusOK)
+
+	s := &EventStream{
+		w:    c.writer,
+		rc:   http.NewResponseController(c.writer),
+		ctx:  c.request.Context(),
+		stop: make(chan struct{}),
+	}
+	s.rc.Flush()
+	if SSEHeartbeat > 0 {
+		go s.heartbeat(SSEHeartbeat)
+	}
+	return s
+}
+
+// Send writes an event. Event and id are left out when empty and must not
+// contain line breaks. Strings and byte slices are sent as is, other data
+// is encoded as JSON.
+func (s *EventStream) Send(event, id string, data interface{}) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n") {
+		return errors.New("event and id of server-sent events must not contain line breaks")
+	}
+	var payload string
+	switch v := data.(type) {
+	case string:
+		payload = v
+	case []byte:
+		payload = string(v)
+	default:
+		b, err := jsonCodec.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		payload = string(b)
+	}
+
+	var b strings.Builder
+	if event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event)
+	}
+	if id != "" {
+		fmt.Fprintf(&b, "id: %s\n", id)
+	}
+	for _, line := range strings.Split(sseLineBreaks.Replace(payload), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+// sseLineBreaks normalizes the line breaks of event data, as clients end
+// a line at CRLF, CR and LF alike.
+var sseLineBreaks = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// Done is closed when the client disconnects.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Close ends the stream. Nothing is written after it returns.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+func (s *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if s.write(": ping\n\n") != nil {
+				return
+			}
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			s.Close()
+			return
+		}
+	}
+}
+
+func (s *EventStream) write(msg string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || s.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+	_, err := io.WriteString(s.w, msg)
+	if err != nil {
+		return err
+	}
+	s.rc.Flush()
+	return nil
+}
@@ -0,0 +1,106 @@
+package apictx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+// BindStream decodes a newline-delimited JSON body one item at a time and
+// calls fn with each of them, so large bulk payloads are never buffered as a
+// whole. Gzip and deflate encoded bodies are decompressed. Struct items get
+// their defaults applied and are validated before fn is called. Decoding
+// stops at the first error, errors returned by fn are passed through
+// unchanged.
+func BindStream[T any](c *Context, fn func(item T) error, opts ...BindOption) error {
+	o := newBindOptions(opts)
+	c.limitBody(o)
+	if httpErr := c.decompressBody(o); httpErr != nil {
+		return httpErr
+	}
+
+	dec := jsonCodec.NewDecoder(c.request.Body)
+	if o.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	for line := 1; ; line++ {
+		var item T
+		val := reflect.ValueOf(&item).Elem()
+		isStruct := val.Kind() == reflect.Struct
+		if isStruct {
+			err := applyDefaults(val)
+			if err != nil {
+				return defaultsError(err)
+			}
+		}
+
+		err := dec.Decode(&item)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if httpErr := bodyTooLarge(err); httpErr != nil {
+				return httpErr
+			}
+			return NewHttpError(
+				"failed to read inputs",
+				fmt.Errorf("failed to decode NDJSON item %d: %w", line, err),
+				http.StatusBadRequest,
+			)
+		}
+
+		if isStruct {
+			if httpErr := validateStruct(c.request.Context(), &item, c.request.Header.Get("Accept-Language"), o); httpErr != nil {
+				return httpErr
+			}
+		}
+		err = fn(item)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// NDJSONWriter writes a newline-delimited JSON response, created by
+// Context.NDJSON.
+type NDJSONWriter struct {
+	enc JSONEncoder
+	rc  *http.ResponseController
+	ctx context.Context
+}
+
+// NDJSON starts an application/x-ndjson response, for streaming large
+// lists item by item instead of building them in memory.
+func (c *Context) NDJSON(code int) *NDJSONWriter {
+	statusCode := code
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	c.writer.Header().Set("Content-Type", "application/x-ndjson")
+	c.writer.WriteHeader(statusCode)
+	return &NDJSONWriter{
+		enc: jsonCodec.NewEncoder(c.writer),
+		rc:  http.NewResponseController(c.writer),
+		ctx: c.request.Context(),
+	}
+}
+
+// Encode writes v as a line and flushes it to the client. It returns
+// ErrStreamClosed once the client has disconnected.
+func (w *NDJSONWriter) Encode(v interface{}) error {
+	if w.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+	err := w.enc.Encode(v)
+	if err != nil {
+		return err
+	}
+	err = w.rc.Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
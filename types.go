@@ -0,0 +1,133 @@
+package apictx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is decoded from duration strings such
+// as "30s" or "5m" in JSON bodies. Numbers are accepted as nanoseconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Duration(value)
+	case string:
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return nil
+}
+
+// DateLayout is the layout of Date values.
+const DateLayout = "2006-01-02"
+
+// Date is a calendar date such as "2024-01-02", in UTC. The `layout` tag
+// only applies to values of the query, path, headers, cookies and forms,
+// so Date is the type for dates in JSON, XML, YAML and MessagePack bodies.
+type Date time.Time
+
+// Time returns d as a time.Time at midnight UTC.
+func (d Date) Time() time.Time {
+	return time.Time(d)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(time.Time(d).Format(DateLayout)), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	t, err := time.Parse(DateLayout, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, want YYYY-MM-DD", text)
+	}
+	*d = Date(t)
+	return nil
+}
+
+// Base64URL is a byte slice encoded as URL-safe base64 in JSON bodies and
+// query values. Padding is optional when decoding and omitted when encoding.
+type Base64URL []byte
+
+func (b Base64URL) MarshalText() ([]byte, error) {
+	return []byte(base64.RawURLEncoding.EncodeToString(b)), nil
+}
+
+func (b *Base64URL) UnmarshalText(text []byte) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(text), "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Optional holds a request value that may be omitted, so PATCH handlers can
+// tell a field that was left out from one set to its zero value or null.
+//
+//	var req struct {
+//		Name apictx.Optional[string] `json:"name"`
+//	}
+//	if req.Name.Set {
+//		user.Name = req.Name.Value
+//	}
+type Optional[T any] struct {
+	Value T
+	// Set reports whether the value was present in the request.
+	Set bool
+	// Null reports whether the value was an explicit JSON null.
+	Null bool
+}
+
+// Get returns the value and whether it was set to something other than null.
+func (o Optional[T]) Get() (T, bool) {
+	return o.Value, o.Set && !o.Null
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if !o.Set || o.Null {
+		return []byte("null"), nil
+	}
+	return json.Marshal(o.Value)
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Null = true
+		var zero T
+		o.Value = zero
+		return nil
+	}
+	o.Null = false
+	return json.Unmarshal(b, &o.Value)
+}
+
+func (o *Optional[T]) UnmarshalText(text []byte) error {
+	err := setValue(reflect.ValueOf(&o.Value).Elem(), boundField{}, string(text))
+	if err != nil {
+		return err
+	}
+	o.Set = true
+	o.Null = false
+	return nil
+}
@@ -0,0 +1,78 @@
+package apictx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FormFile returns the first file uploaded in the multipart form field name.
+// A missing file is reported as a 400 *HttpError.
+func (c *Context) FormFile(name string) (*multipart.FileHeader, error) {
+	if c.request.MultipartForm == nil {
+		err := c.request.ParseMultipartForm(MaxMultipartMemory)
+		if err != nil {
+			return nil, NewHttpError("failed to read inputs", fmt.Errorf("failed to parse multipart form: %w", err), http.StatusBadRequest)
+		}
+	}
+	f, fh, err := c.request.FormFile(name)
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			return nil, NewHttpError(fmt.Sprintf("missing file %s", name), err, http.StatusBadRequest)
+		}
+		return nil, NewHttpError("failed to read inputs", err, http.StatusBadRequest)
+	}
+	f.Close()
+	return fh, nil
+}
+
+// SaveUploadedFile writes the uploaded file fh to dst. When dst is an
+// existing directory, or ends with a path separator, the file is stored in
+// it under its client supplied name stripped of any directory components.
+// Destinations containing ".." elements are rejected, so client supplied
+// names cannot escape the intended directory.
+func (c *Context) SaveUploadedFile(fh *multipart.FileHeader, dst string) error {
+	if slices.Contains(strings.FieldsFunc(filepath.ToSlash(dst), isSlash), "..") {
+		return fmt.Errorf("invalid upload destination %q", dst)
+	}
+
+	if info, err := os.Stat(dst); (err == nil && info.IsDir()) || strings.HasSuffix(filepath.ToSlash(dst), "/") {
+		name := filepath.Base(filepath.Clean("/" + filepath.ToSlash(fh.Filename)))
+		if name == "/" || name == "." || name == string(filepath.Separator) {
+			return fmt.Errorf("invalid upload file name %q", fh.Filename)
+		}
+		dst = filepath.Join(dst, name)
+	}
+
+	src, err := fh.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open uploaded file: %w", err)
+	}
+	defer src.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0o750)
+	if err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, src)
+	if err != nil {
+		return fmt.Errorf("failed to save uploaded file: %w", err)
+	}
+	return out.Close()
+}
+
+func isSlash(r rune) bool {
+	return r == '/'
+}
@@ -0,0 +1,85 @@
+package apictx
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func uploadRequest(t *testing.T, filename, content string) *Context {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return newTestContext(r)
+}
+
+func TestSaveUploadedFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		want     string
+	}{
+		{"plain", "report.pdf", "report.pdf"},
+		{"relative traversal", "../../etc/passwd", "passwd"},
+		{"absolute path", "/etc/passwd", "passwd"},
+		{"windows path", `..\..\evil.txt`, `..\..\evil.txt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c := uploadRequest(t, tt.filename, "content")
+			fh, err := c.FormFile("file")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.SaveUploadedFile(fh, dir+string(filepath.Separator)); err != nil {
+				t.Fatal(err)
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 || entries[0].Name() != filepath.Base(tt.want) {
+				t.Fatalf("got %v, want only %s", entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveUploadedFileRejectsTraversal(t *testing.T) {
+	dir := t.TempDir()
+	c := uploadRequest(t, "a.txt", "content")
+	fh, err := c.FormFile("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dst := range []string{
+		dir + "/../a.txt",
+		dir + "/sub/../../a.txt",
+		"../a.txt",
+	} {
+		if err := c.SaveUploadedFile(fh, dst); err == nil {
+			t.Errorf("%s: want an error", dst)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "a.txt")); err == nil {
+		t.Error("file was written outside of the destination directory")
+	}
+}
+
+func TestFormFileMissing(t *testing.T) {
+	c := uploadRequest(t, "a.txt", "content")
+	_, err := c.FormFile("other")
+	if httpErr, ok := err.(*HttpError); !ok || httpErr.Status() != http.StatusBadRequest {
+		t.Fatalf("got %v", err)
+	}
+}
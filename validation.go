@@ -0,0 +1,485 @@
+package apictx
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+)
+
+// FlatValidationErrors leaves the per-field errors out of error responses,
+// so validation failures are only described by the joined message.
+var FlatValidationErrors bool
+
+// validate is the validator shared by every Bind call, so struct tags are
+// parsed once per type and custom rules apply everywhere.
+var validate = validator.New()
+
+// Validator validates bound structs. Errors other than the
+// validator.ValidationErrors of go-playground/validator are reported to
+// the client as a validation failure with the message of the error.
+type Validator interface {
+	Struct(data interface{}) error
+}
+
+// ContextValidator is implemented by validators that take the context of
+// the request.
+type ContextValidator interface {
+	StructCtx(ctx context.Context, data interface{}) error
+}
+
+// structValidator validates the structs of Bind and Validate.
+var structValidator Validator = validate
+
+// SetValidator replaces the validator used by Bind and Validate, e.g. to
+// use ozzo-validation or hand written checks. The Register functions of
+// this package only configure the built-in validator. It is not safe for
+// concurrent use and should be called during initialization.
+func SetValidator(v Validator) {
+	structValidator = v
+}
+
+// translators holds the validation message translations, English is used
+// when none of the languages accepted by the client is registered.
+var translators = ut.New(en.New())
+
+// nameTags are the tags whose names identify a field in validation errors,
+// in order of preference.
+var nameTags = []string{"json", "query", "path", "form", "header", "cookie", "xml"}
+
+// wireName returns the name clients use for a field. The validator falls
+// back to the Go field name when it is empty.
+func wireName(sf reflect.StructField) string {
+	for _, tag := range nameTags {
+		name, _ := parseTag(sf.Tag.Get(tag))
+		if name == "-" {
+			continue
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func init() {
+	validate.RegisterTagNameFunc(wireName)
+
+	trans, _ := translators.GetTranslator("en")
+	err := en_translations.RegisterDefaultTranslations(validate, trans)
+	if err != nil {
+		panic(err)
+	}
+	// list the allowed values like the errors of Enum types do
+	err = validate.RegisterTranslation("oneof", trans, func(t ut.Translator) error {
+		return t.Add("oneof", "{0} must be one of {1}", true)
+	}, func(t ut.Translator, fe validator.FieldError) string {
+		msg, _ := t.T("oneof", fe.Field(), strings.Join(strings.Fields(fe.Param()), ", "))
+		return msg
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// RegisterValidationLocale adds a language for validation messages, chosen
+// from the Accept-Language header of the request, e.g.
+//
+//	apictx.RegisterValidationLocale(fr.New(), fr_translations.RegisterDefaultTranslations)
+//
+// It is not safe for concurrent use and should be called during initialization.
+func RegisterValidationLocale(locale locales.Translator, register func(v *validator.Validate, trans ut.Translator) error) error {
+	err := translators.AddTranslator(locale, true)
+	if err != nil {
+		return err
+	}
+	trans, _ := translators.GetTranslator(locale.Locale())
+	return register(validate, trans)
+}
+
+// RegisterValidation adds a custom validation rule usable in `validate` tags,
+// e.g. apictx.RegisterValidation("slug", isSlug). It is not safe for
+// concurrent use and should be called during initialization.
+func RegisterValidation(tag string, fn validator.Func, callValidationEvenIfNull ...bool) error {
+	return validate.RegisterValidation(tag, fn, callValidationEvenIfNull...)
+}
+
+// RegisterValidationCtx adds a custom validation rule that receives the
+// context of the request, for rules that query a database or another
+// service and should stop when the client goes away. It is not safe for
+// concurrent use and should be called during initialization.
+func RegisterValidationCtx(tag string, fn validator.FuncCtx, callValidationEvenIfNull ...bool) error {
+	return validate.RegisterValidationCtx(tag, fn, callValidationEvenIfNull...)
+}
+
+// RegisterAlias adds a shorthand for a set of rules, e.g.
+// apictx.RegisterAlias("username", "required,alphanum,min=3,max=30"). It
+// is not safe for concurrent use and should be called during initialization.
+func RegisterAlias(alias, tags string) {
+	validate.RegisterAlias(alias, tags)
+}
+
+// RegisterTagNameFunc changes how fields are named in validation errors,
+// replacing the lookup of their json, query and other binding tags. It is
+// not safe for concurrent use and should be called during initialization.
+func RegisterTagNameFunc(fn validator.TagNameFunc) {
+	validate.RegisterTagNameFunc(fn)
+}
+
+// RegisterStructValidation adds a struct level validation for the given
+// types, for rules spanning several fields such as StartDate < EndDate. It
+// is not safe for concurrent use and should be called during initialization.
+func RegisterStructValidation(fn validator.StructLevelFunc, types ...interface{}) {
+	validate.RegisterStructValidation(fn, types...)
+}
+
+// ValidationError is the cause of the HttpError returned when a bound
+// struct fails validation. It gives access to the errors reported by the
+// validator:
+//
+//	var verr *apictx.ValidationError
+//	if errors.As(err, &verr) {
+//		for _, e := range verr.Errors { ... }
+//	}
+type ValidationError struct {
+	Errors validator.ValidationErrors
+}
+
+func (e *ValidationError) Error() string {
+	return e.Errors.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Errors
+}
+
+// validateStruct validates data using its `validate` tags, passing ctx to
+// the rules added with RegisterValidationCtx. Messages are translated to
+// the best match of acceptLanguage.
+func validateStruct(ctx context.Context, data interface{}, acceptLanguage string, o BindOptions) *HttpError {
+	if o.SkipValidation {
+		return nil
+	}
+	if val := reflect.Indirect(reflect.ValueOf(data)); val.Kind() != reflect.Struct {
+		return validateElems(ctx, val, acceptLanguage, o)
+	}
+	var err error
+	switch v := structValidator.(type) {
+	case *validator.Validate:
+		except := groupExcludes(reflect.TypeOf(data), o.ValidationGroup)
+		switch {
+		case len(except) > 0:
+			err = v.StructFilteredCtx(ctx, data, groupFilter(reflect.TypeOf(data), except, o.PartialFields))
+		case o.PartialFields != nil:
+			err = v.StructPartialCtx(ctx, data, o.PartialFields...)
+		default:
+			err = v.StructCtx(ctx, data)
+		}
+	case ContextValidator:
+		err = v.StructCtx(ctx, data)
+	default:
+		err = v.Struct(data)
+	}
+	if err != nil {
+		var httpErr *HttpError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		var invalidErr *validator.InvalidValidationError
+		if errors.As(err, &invalidErr) {
+			return NewHttpError("failed to validate inputs", err, http.StatusInternalServerError)
+		}
+		var validationErrs validator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			return NewHttpError(fmt.Sprintf("validation error(s): %s", err), err, http.StatusBadRequest)
+		}
+		typ := reflect.TypeOf(data)
+		trans, _ := translators.FindTranslator(acceptedLanguages(acceptLanguage)...)
+		var errMsgs []string
+		var fields []FieldError
+		for _, e := range validationErrs {
+			msg := validationMessage(typ, e, trans)
+			errMsgs = append(errMsgs, msg)
+			fields = append(fields, FieldError{Field: fieldPath(typ, e.Namespace(), e.StructNamespace()), Rule: e.Tag(), Param: e.Param(), Message: msg})
+		}
+		return newValidationError(validationErrs, errMsgs, fields)
+	}
+	return nil
+}
+
+// validateElems validates the struct elements of a slice or array bound as
+// a whole, e.g. by Bind[[]Item], naming fields by their index such as
+// "[2].price". Other values have no rules to check.
+func validateElems(ctx context.Context, val reflect.Value, acceptLanguage string, o BindOptions) *HttpError {
+	if val.Kind() != reflect.Slice && val.Kind() != reflect.Array {
+		return nil
+	}
+	var (
+		errMsgs        []string
+		fields         []FieldError
+		validationErrs validator.ValidationErrors
+	)
+	for i := 0; i < val.Len(); i++ {
+		elem := reflect.Indirect(val.Index(i))
+		if elem.Kind() != reflect.Struct {
+			continue
+		}
+		httpErr := validateStruct(ctx, elem.Interface(), acceptLanguage, o)
+		if httpErr == nil {
+			continue
+		}
+		var verr *ValidationError
+		if !errors.As(httpErr, &verr) {
+			return httpErr
+		}
+		validationErrs = append(validationErrs, verr.Errors...)
+		for _, f := range httpErr.fields {
+			f.Field = fmt.Sprintf("[%d].%s", i, f.Field)
+			errMsgs = append(errMsgs, f.Message)
+			fields = append(fields, f)
+		}
+	}
+	if fields == nil {
+		return nil
+	}
+	return newValidationError(validationErrs, errMsgs, fields)
+}
+
+// newValidationError returns the 400 of failed validation. Besides the
+// list of fields, its details hold the messages of each field keyed by
+// its path, as form UIs look them up.
+func newValidationError(validationErrs validator.ValidationErrors, errMsgs []string, fields []FieldError) *HttpError {
+	httpErr := NewHttpError(
+		fmt.Sprintf("validation error(s): %s", strings.Join(errMsgs, ", ")),
+		&ValidationError{Errors: validationErrs},
+		http.StatusBadRequest,
+	)
+	httpErr.fields = fields
+	httpErr.details = map[string]interface{}{}
+	for _, f := range fields {
+		msgs, _ := httpErr.details[f.Field].([]string)
+		httpErr.details[f.Field] = append(msgs, f.Message)
+	}
+	return httpErr
+}
+
+// groupExcludes returns the paths of the fields of typ whose `groups` tag
+// does not list group, by Go names and without indexes, such as
+// "Items.Price" for a field of the elements of a slice.
+func groupExcludes(typ reflect.Type, group string) []string {
+	if group == "" {
+		return nil
+	}
+	return appendGroupExcludes(nil, typ, group, "", map[reflect.Type]bool{})
+}
+
+func appendGroupExcludes(except []string, typ reflect.Type, group, prefix string, seen map[reflect.Type]bool) []string {
+	for typ != nil && (typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map) {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct || seen[typ] {
+		return except
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		if groups, ok := sf.Tag.Lookup("groups"); ok && !slices.Contains(strings.Split(groups, ","), group) {
+			except = append(except, prefix+sf.Name)
+			continue
+		}
+		except = appendGroupExcludes(except, sf.Type, group, prefix+sf.Name+".", seen)
+	}
+	return except
+}
+
+// groupFilter returns the filter of validator's StructFiltered skipping
+// the fields of typ at the paths of except, whatever the index of the
+// element they are in. StructExcept needs the indexes, so it cannot skip
+// the fields of every element of a slice. The fields not listed in
+// partial, if any, are skipped too, like StructPartial does.
+func groupFilter(typ reflect.Type, except, partial []string) validator.FilterFunc {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	prefix := ""
+	if typ.Name() != "" {
+		prefix = typ.Name() + "." // the namespace of named types starts with the type name
+	}
+	include := partialNamespaces(prefix, partial)
+	return func(ns []byte) bool {
+		if _, ok := include[string(ns)]; include != nil && !ok {
+			return true
+		}
+		names := strings.Split(strings.TrimPrefix(string(ns), prefix), ".")
+		for i := range names {
+			names[i], _, _ = strings.Cut(names[i], "[")
+		}
+		path := strings.Join(names, ".")
+		return slices.ContainsFunc(except, func(e string) bool { return path == e || strings.HasPrefix(path, e+".") })
+	}
+}
+
+// partialNamespaces returns the namespaces StructPartial validates for
+// fields, which are the fields and the fields and elements they are in.
+func partialNamespaces(prefix string, fields []string) map[string]bool {
+	if fields == nil {
+		return nil
+	}
+	include := map[string]bool{}
+	for _, f := range fields {
+		ns := prefix
+		for _, name := range strings.Split(f, ".") {
+			for {
+				open, end := strings.Index(name, "["), strings.Index(name, "]")
+				if open < 0 || end < open {
+					break
+				}
+				include[ns+name[:open]] = true
+				ns += name[:end+1]
+				include[ns] = true
+				name = name[end+1:]
+			}
+			ns += name
+			include[ns] = true
+			ns += "."
+		}
+	}
+	return include
+}
+
+// validationMessage describes a failed validation rule of a field of typ.
+// The `errmsg` tag of the field replaces the generated message, otherwise
+// the translation of the rule is used. Rules without one get a generic
+// message.
+func validationMessage(typ reflect.Type, e validator.FieldError, trans ut.Translator) string {
+	if sf, ok := fieldByNamespace(typ, e.StructNamespace()); ok {
+		if msg := sf.Tag.Get("errmsg"); msg != "" {
+			return msg
+		}
+	}
+	if msg := e.Translate(trans); msg != e.Error() {
+		return msg
+	}
+	return fmt.Sprintf("validation failed for %s", e.Field())
+}
+
+// fieldByNamespace finds the struct field of typ at a validator namespace
+// such as "Request.Items[2].Price".
+func fieldByNamespace(typ reflect.Type, namespace string) (reflect.StructField, bool) {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	names := strings.Split(namespace, ".")
+	if typ.Name() != "" {
+		names = names[1:] // the namespace of named types starts with the type name
+	}
+	var sf reflect.StructField
+	for _, name := range names {
+		name, _, _ = strings.Cut(name, "[")
+		for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return reflect.StructField{}, false
+		}
+		var ok bool
+		sf, ok = typ.FieldByName(name)
+		if !ok {
+			return reflect.StructField{}, false
+		}
+		typ = sf.Type
+	}
+	return sf, len(names) > 0
+}
+
+// fieldPath turns a validator namespace of a field of typ, such as
+// "Order.items[2].price", into the path of the field in the request,
+// "items[2].price". Untagged embedded structs are left out, as their
+// fields are sent as fields of the outer struct. structNamespace is the
+// same namespace with Go field names.
+func fieldPath(typ reflect.Type, namespace, structNamespace string) string {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	names := strings.Split(namespace, ".")
+	goNames := strings.Split(structNamespace, ".")
+	if typ.Name() != "" {
+		names, goNames = names[1:], goNames[1:]
+	}
+	var path []string
+	for i, name := range names {
+		if i < len(goNames) {
+			goName, _, _ := strings.Cut(goNames[i], "[")
+			for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+				typ = typ.Elem()
+			}
+			if typ.Kind() == reflect.Struct {
+				if sf, ok := typ.FieldByName(goName); ok {
+					typ = sf.Type
+					if sf.Anonymous && wireName(sf) == "" && i < len(names)-1 {
+						continue
+					}
+				}
+			}
+		}
+		path = append(path, name)
+	}
+	return strings.Join(path, ".")
+}
+
+// acceptedLanguages returns the locales of an Accept-Language header in the
+// notation of go-playground/locales, most preferred first. Regional
+// variants are followed by their base language, so "pt-BR" yields "pt_BR"
+// and "pt".
+func acceptedLanguages(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var langs []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		langs = append(langs, language{strings.ReplaceAll(tag, "-", "_"), q})
+	}
+	slices.SortStableFunc(langs, func(a, b language) int {
+		return cmp.Compare(b.q, a.q)
+	})
+
+	var tags []string
+	for _, l := range langs {
+		if l.q <= 0 {
+			continue
+		}
+		tags = append(tags, l.tag)
+		if base, _, ok := strings.Cut(l.tag, "_"); ok {
+			tags = append(tags, base)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,53 @@
+package apictx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type groupItem struct {
+	SKU   string `json:"sku" validate:"required"`
+	Price int    `json:"price" validate:"required" groups:"create"`
+}
+
+type groupRequest struct {
+	Name   string               `json:"name" validate:"required" groups:"create"`
+	Email  string               `json:"email" validate:"required"`
+	Items  []groupItem          `json:"items" validate:"dive"`
+	Lookup map[string]groupItem `json:"lookup" validate:"dive"`
+}
+
+func TestValidationGroups(t *testing.T) {
+	body := `{"items":[{"sku":"a"},{}],"lookup":{"k":{"sku":"b"}}}`
+	tests := []struct {
+		name string
+		opts []BindOption
+		want []string
+	}{
+		{"no group", nil, []string{"name", "email", "items[0].price", "items[1].sku", "items[1].price", "lookup[k].price"}},
+		{"create", []BindOption{ValidationGroup("create")}, []string{"name", "email", "items[0].price", "items[1].sku", "items[1].price", "lookup[k].price"}},
+		{"update", []BindOption{ValidationGroup("update")}, []string{"email", "items[1].sku"}},
+		{"update partial", []BindOption{ValidationGroup("update"), WithPartial("Name", "Items[1].SKU")}, []string{"items[1].sku"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/json")
+			var req groupRequest
+			err := newTestContext(r).Bind(&req, tt.opts...)
+			if err == nil {
+				t.Fatal("want a validation error")
+			}
+			var fields []string
+			for _, f := range err.Fields() {
+				fields = append(fields, f.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("got fields %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
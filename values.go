@@ -0,0 +1,673 @@
+package apictx
+
+import (
+	"encoding"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeadersType     = reflect.TypeOf([]*multipart.FileHeader(nil))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	durationTypes       = []reflect.Type{reflect.TypeOf(time.Duration(0)), reflect.TypeOf(Duration(0))}
+)
+
+// Enum is implemented by custom string or integer types with a fixed set of
+// values. Binding such a type from any other value fails with an error
+// listing the allowed ones.
+type Enum interface {
+	EnumValues() []string
+}
+
+var enumType = reflect.TypeOf((*Enum)(nil)).Elem()
+
+var parsers = map[reflect.Type]func(string) (reflect.Value, error){}
+
+// RegisterParser makes parse the conversion used to bind string values to
+// fields of type T, e.g. apictx.RegisterParser(uuid.Parse). Parsers take
+// priority over encoding.TextUnmarshaler. It is not safe for concurrent use
+// and should be called during initialization.
+func RegisterParser[T any](parse func(string) (T, error)) {
+	parsers[reflect.TypeOf((*T)(nil)).Elem()] = func(s string) (reflect.Value, error) {
+		v, err := parse(s)
+		return reflect.ValueOf(&v).Elem(), err
+	}
+}
+
+// valueSource provides the raw values bound to tagged fields.
+type valueSource interface {
+	Values(key string) []string
+}
+
+// keyedSource is implemented by the value sources that can list their keys,
+// which is required to bind map fields.
+type keyedSource interface {
+	Keys() []string
+}
+
+type mapSource map[string][]string
+
+func (s mapSource) Values(key string) []string {
+	return s[key]
+}
+
+func (s mapSource) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// foldSource matches keys case-insensitively, preferring an exact match.
+type foldSource struct {
+	mapSource
+}
+
+func (s foldSource) Values(key string) []string {
+	if values, ok := s.mapSource[key]; ok {
+		return values
+	}
+	for k, values := range s.mapSource {
+		if strings.EqualFold(k, key) {
+			return values
+		}
+	}
+	return nil
+}
+
+type pathSource struct {
+	r *http.Request
+}
+
+func (s pathSource) Values(key string) []string {
+	if v := s.r.PathValue(key); v != "" {
+		return []string{v}
+	}
+	return nil
+}
+
+type cookieSource struct {
+	r *http.Request
+}
+
+func (s cookieSource) Values(key string) []string {
+	var values []string
+	for _, cookie := range s.r.Cookies() {
+		if cookie.Name == key {
+			values = append(values, cookie.Value)
+		}
+	}
+	return values
+}
+
+// tagOptions are the comma separated options following the name in a
+// binding tag, e.g. `query:"tags,comma"`.
+type tagOptions []string
+
+func parseTag(tag string) (string, tagOptions) {
+	name, opts, _ := strings.Cut(tag, ",")
+	if opts == "" {
+		return name, nil
+	}
+	return name, strings.Split(opts, ",")
+}
+
+func (o tagOptions) Has(opt string) bool {
+	for _, v := range o {
+		if v == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// boundField describes how a struct field is bound from a value source.
+type boundField struct {
+	name   string
+	opts   tagOptions
+	layout string
+}
+
+// cachedField is the binding metadata of a struct field, parsed once per
+// struct type and tag name.
+type cachedField struct {
+	index      int
+	fieldName  string
+	name       string
+	opts       tagOptions
+	layout     string
+	def        string
+	hasDefault bool
+	defErr     error // set when def cannot be converted to the field type
+	embedded   bool
+	nested     bool
+	isMap      bool
+}
+
+type fieldCacheKey struct {
+	typ     reflect.Type
+	tagName string
+}
+
+var fieldCache sync.Map // fieldCacheKey -> []cachedField
+
+// cachedFields returns the exported and embedded fields of typ, with their
+// tagName tags parsed.
+func cachedFields(typ reflect.Type, tagName string) []cachedField {
+	key := fieldCacheKey{typ, tagName}
+	if fields, ok := fieldCache.Load(key); ok {
+		return fields.([]cachedField)
+	}
+
+	var fields []cachedField
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		name, opts := parseTag(sf.Tag.Get(tagName))
+		def, hasDefault := sf.Tag.Lookup("default")
+		var defErr error
+		if hasDefault && !isNested(sf.Type) {
+			f := boundField{name: sf.Name, opts: tagOptions{"comma"}, layout: sf.Tag.Get("layout")}
+			err := setField(reflect.New(sf.Type).Elem(), f, []string{def})
+			if err != nil {
+				// a bug of the struct, not of the request, so no *HttpError
+				defErr = fmt.Errorf("invalid default %q for field %s of %s: %v", def, sf.Name, typ, err)
+			}
+		}
+		fields = append(fields, cachedField{
+			index:      i,
+			fieldName:  sf.Name,
+			name:       name,
+			opts:       opts,
+			layout:     sf.Tag.Get("layout"),
+			def:        def,
+			hasDefault: hasDefault,
+			defErr:     defErr,
+			embedded:   sf.Anonymous,
+			nested:     isNested(sf.Type),
+			isMap:      sf.Type.Kind() == reflect.Map,
+		})
+	}
+
+	actual, _ := fieldCache.LoadOrStore(key, fields)
+	return actual.([]cachedField)
+}
+
+func (cf cachedField) boundField(path []string) boundField {
+	return boundField{name: strings.Join(path, "."), opts: cf.opts, layout: cf.layout}
+}
+
+// bindValues sets the fields of data tagged with tagName from src.
+//
+// Slice fields receive every value of a repeated key. With the `comma` tag
+// option each value is also split on commas, so ?tag=a,b&tag=c binds
+// []string{"a", "b", "c"}. Other fields receive the first value.
+//
+// Embedded structs are bound as if their fields were declared on the outer
+// struct. The fields of a tagged nested struct are looked up with the tag
+// name as prefix, so `query:"address"` binds its `query:"city"` field from
+// address.city or address[city].
+func bindValues(data interface{}, tagName string, src valueSource) error {
+	_, err := bindStruct(reflect.ValueOf(data).Elem(), tagName, src, nil)
+	return err
+}
+
+// bindStruct binds the fields of val and reports whether any was set.
+func bindStruct(val reflect.Value, tagName string, src valueSource, prefix []string) (bool, error) {
+	bound := false
+
+	for _, cf := range cachedFields(val.Type(), tagName) {
+		field := val.Field(cf.index)
+		if cf.name == "" {
+			if !cf.embedded || !cf.nested {
+				continue
+			}
+			ok, err := bindNested(field, tagName, src, prefix)
+			if err != nil {
+				return false, err
+			}
+			bound = bound || ok
+			continue
+		}
+
+		path := append(prefix[:len(prefix):len(prefix)], cf.name)
+		if cf.isMap {
+			ok, err := bindMap(field, cf.boundField(path), src, path)
+			if err != nil {
+				return false, err
+			}
+			bound = bound || ok
+			continue
+		}
+		if cf.nested {
+			ok, err := bindNested(field, tagName, src, path)
+			if err != nil {
+				return false, err
+			}
+			bound = bound || ok
+			continue
+		}
+
+		values := lookupValues(src, path)
+		if len(values) == 0 && field.Kind() == reflect.Slice {
+			values = lookupIndexed(src, path)
+		}
+		if len(values) == 0 {
+			continue
+		}
+		err := setField(field, cf.boundField(path), values)
+		if err != nil {
+			return false, err
+		}
+		bound = true
+	}
+
+	return bound, nil
+}
+
+// lookupIndexed returns the values of the indexed keys at path ordered by
+// index, so ids[1]=b&ids[0]=a yields []string{"a", "b"}.
+func lookupIndexed(src valueSource, path []string) []string {
+	keyed, ok := src.(keyedSource)
+	if !ok {
+		return nil
+	}
+	prefix := path[0]
+	for _, p := range path[1:] {
+		prefix += "[" + p + "]"
+	}
+	prefix += "["
+
+	type indexed struct {
+		index  int
+		values []string
+	}
+	var found []indexed
+	for _, k := range keyed.Keys() {
+		rest, ok := strings.CutPrefix(k, prefix)
+		if !ok {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(rest, "]"))
+		if err != nil || !strings.HasSuffix(rest, "]") || index < 0 {
+			continue
+		}
+		found = append(found, indexed{index, src.Values(k)})
+	}
+	slices.SortFunc(found, func(a, b indexed) int { return a.index - b.index })
+
+	var values []string
+	for _, f := range found {
+		values = append(values, f.values...)
+	}
+	return values
+}
+
+// bindMap sets a map field with string keys from the keys of src prefixed
+// by path, so `query:"filter"` binds ?filter[status]=open&filter.owner=me
+// to map[string]string{"status": "open", "owner": "me"}.
+func bindMap(field reflect.Value, f boundField, src valueSource, path []string) (bool, error) {
+	keyed, ok := src.(keyedSource)
+	typ := field.Type()
+	if !ok || typ.Key().Kind() != reflect.String {
+		return false, nil
+	}
+	elem := typ.Elem()
+	if !isScalar(elem) && (elem.Kind() != reflect.Slice || !isScalar(elem.Elem())) {
+		return false, nil
+	}
+
+	dotted := strings.Join(path, ".") + "."
+	bracketed := path[0]
+	for _, p := range path[1:] {
+		bracketed += "[" + p + "]"
+	}
+	bracketed += "["
+
+	bound := false
+	for _, k := range keyed.Keys() {
+		key, ok := strings.CutPrefix(k, dotted)
+		if !ok {
+			key, ok = strings.CutPrefix(k, bracketed)
+			if !ok || !strings.HasSuffix(key, "]") {
+				continue
+			}
+			key = strings.TrimSuffix(key, "]")
+			if strings.ContainsAny(key, "[]") {
+				continue
+			}
+		}
+		if key == "" {
+			continue
+		}
+
+		v := reflect.New(elem).Elem()
+		err := setField(v, boundField{name: f.name + "[" + key + "]", opts: f.opts, layout: f.layout}, src.Values(k))
+		if err != nil {
+			return false, err
+		}
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(typ))
+		}
+		field.SetMapIndex(reflect.ValueOf(key).Convert(typ.Key()), v)
+		bound = true
+	}
+
+	return bound, nil
+}
+
+// applyDefaults sets the zero valued fields of val that have a `default`
+// tag. Slice defaults are split on commas.
+func applyDefaults(val reflect.Value) error {
+	for _, cf := range cachedFields(val.Type(), "default") {
+		field := val.Field(cf.index)
+		if cf.nested {
+			if field.Kind() == reflect.Pointer {
+				if field.IsNil() {
+					continue
+				}
+				field = field.Elem()
+			}
+			err := applyDefaults(field)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !cf.hasDefault || !field.IsZero() || !field.CanSet() {
+			continue
+		}
+		if cf.defErr != nil {
+			return cf.defErr
+		}
+		f := boundField{name: cf.fieldName, opts: tagOptions{"comma"}, layout: cf.layout}
+		err := setField(field, f, []string{cf.def})
+		if err != nil {
+			return fmt.Errorf("invalid default for field %s: %v", cf.fieldName, err)
+		}
+	}
+
+	return nil
+}
+
+// defaultsError reports an invalid default tag or an unknown modifier. It
+// is a bug of the struct rather than of the request, so it is answered as
+// an internal error.
+func defaultsError(err error) *HttpError {
+	return NewHttpError("Internal error", err, http.StatusInternalServerError)
+}
+
+// bindNested binds a struct or struct pointer field. Pointers are only
+// allocated when one of the nested fields is set.
+func bindNested(field reflect.Value, tagName string, src valueSource, prefix []string) (bool, error) {
+	if field.Kind() != reflect.Pointer {
+		return bindStruct(field, tagName, src, prefix)
+	}
+	if !field.IsNil() {
+		return bindStruct(field.Elem(), tagName, src, prefix)
+	}
+	if !field.CanSet() {
+		return false, nil
+	}
+	ptr := reflect.New(field.Type().Elem())
+	ok, err := bindStruct(ptr.Elem(), tagName, src, prefix)
+	if ok {
+		field.Set(ptr)
+	}
+	return ok, err
+}
+
+// isNested reports whether typ is a struct, or pointer to one, whose fields
+// are bound individually.
+func isNested(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Struct && !isScalar(typ)
+}
+
+// lookupValues returns the values of the key at path, trying the dotted
+// form a.b.c before the bracketed form a[b][c].
+func lookupValues(src valueSource, path []string) []string {
+	if len(path) == 1 {
+		return src.Values(path[0])
+	}
+	values := src.Values(strings.Join(path, "."))
+	if len(values) > 0 {
+		return values
+	}
+	return src.Values(path[0] + "[" + strings.Join(path[1:], "][") + "]")
+}
+
+// setField sets field from values. Pointer fields are only allocated when a
+// value is present, so nil means the parameter was not supplied.
+func setField(field reflect.Value, f boundField, values []string) error {
+	if field.Kind() == reflect.Pointer && isScalar(field.Type().Elem()) {
+		ptr := reflect.New(field.Type().Elem())
+		err := setValue(ptr.Elem(), f, values[0])
+		if err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+	if field.Kind() != reflect.Slice || isScalar(field.Type()) {
+		return setValue(field, f, values[0]) // Use the first value
+	}
+	if !isScalar(field.Type().Elem()) {
+		return nil
+	}
+
+	if f.opts.Has("comma") {
+		var split []string
+		for _, v := range values {
+			split = append(split, strings.Split(v, ",")...)
+		}
+		values = split
+	}
+
+	slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+	for i, v := range values {
+		err := setValue(slice.Index(i), f, v)
+		if err != nil {
+			return err
+		}
+	}
+	field.Set(slice)
+	return nil
+}
+
+// isScalar reports whether setValue can convert a string to typ.
+func isScalar(typ reflect.Type) bool {
+	if _, ok := parsers[typ]; ok {
+		return true
+	}
+	if typ == timeType || isDuration(typ) || isTextUnmarshaler(typ) || isBytes(typ) {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+func isDuration(typ reflect.Type) bool {
+	for _, t := range durationTypes {
+		if typ == t {
+			return true
+		}
+	}
+	return false
+}
+
+func isBytes(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8
+}
+
+func isTextUnmarshaler(typ reflect.Type) bool {
+	return reflect.PointerTo(typ).Implements(textUnmarshalerType)
+}
+
+// setValue converts value to the type of field. time.Time fields are parsed
+// as RFC 3339 unless the field has a `layout` tag, which body decoders
+// ignore, see Date. Durations are parsed with time.ParseDuration, []byte
+// fields are decoded as base64 with the standard alphabet, or the URL-safe
+// one with the `base64url` tag option, and types implementing
+// encoding.TextUnmarshaler decode themselves, unless a parser is
+// registered for the type of field.
+func setValue(field reflect.Value, f boundField, value string) error {
+	name := f.name
+	if field.Type().Implements(enumType) {
+		allowed := field.Interface().(Enum).EnumValues()
+		if !slices.Contains(allowed, value) {
+			return NewHttpError(
+				fmt.Sprintf("invalid value for parameter %s: must be one of %s", name, strings.Join(allowed, ", ")),
+				nil,
+				http.StatusBadRequest,
+			)
+		}
+	}
+	if parse, ok := parsers[field.Type()]; ok {
+		v, err := parse(value)
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.Set(v)
+		return nil
+	}
+	if isDuration(field.Type()) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	if field.Type() == timeType {
+		layout := f.layout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if isTextUnmarshaler(field.Type()) {
+		err := field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		return nil
+	}
+
+	if isBytes(field.Type()) {
+		enc := base64.RawStdEncoding
+		if f.opts.Has("base64url") {
+			enc = base64.RawURLEncoding
+		}
+		b, err := enc.DecodeString(strings.TrimRight(value, "="))
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetBytes(b)
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		intValue, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetInt(intValue)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		uintValue, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetUint(uintValue)
+	case reflect.Float32, reflect.Float64:
+		floatValue, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetFloat(floatValue)
+	case reflect.Bool:
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return conversionError(name, field, err)
+		}
+		field.SetBool(boolValue)
+		// Add cases for other types as needed
+	}
+	return nil
+}
+
+// conversionError reports a parameter that could not be converted to the
+// type of its field.
+func conversionError(name string, field reflect.Value, err error) *HttpError {
+	return NewHttpError(
+		fmt.Sprintf("failed to convert parameter %s to %s", name, typeName(field.Type())),
+		err,
+		http.StatusBadRequest,
+	)
+}
+
+func typeName(typ reflect.Type) string {
+	switch {
+	case typ == timeType:
+		return "time"
+	case isDuration(typ):
+		return "duration"
+	case parsers[typ] != nil, isTextUnmarshaler(typ):
+		return typ.String()
+	case isBytes(typ):
+		return "base64"
+	}
+	return typ.Kind().String()
+}
+
+// bindFiles sets the file header fields of data tagged with tagName from files.
+func bindFiles(data interface{}, tagName string, files map[string][]*multipart.FileHeader) error {
+	val := reflect.ValueOf(data).Elem()
+
+	for _, cf := range cachedFields(val.Type(), tagName) {
+		headers, ok := files[cf.name]
+		if cf.name == "" || !ok || len(headers) == 0 {
+			continue
+		}
+		field := val.Field(cf.index)
+		switch field.Type() {
+		case fileHeaderType:
+			field.Set(reflect.ValueOf(headers[0]))
+		case fileHeadersType:
+			field.Set(reflect.ValueOf(headers))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package apictx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestContext(r *http.Request) *Context {
+	c := NewContext(httptest.NewRecorder(), r, nil)
+	return &c
+}
+
+type listQuery struct {
+	Page    int           `query:"page" default:"1"`
+	PerPage uint16        `query:"per_page" default:"20"`
+	Sort    string        `query:"sort" mod:"trim,lcase"`
+	Tags    []string      `query:"tag,comma"`
+	IDs     []int         `query:"id"`
+	Min     *float64      `query:"min"`
+	Active  bool          `query:"active"`
+	Since   time.Time     `query:"since" layout:"2006-01-02"`
+	Timeout time.Duration `query:"timeout"`
+	Address struct {
+		City string `query:"city"`
+	} `query:"address"`
+}
+
+func TestBindQuery(t *testing.T) {
+	min := 1.5
+	tests := []struct {
+		name  string
+		query string
+		want  listQuery
+	}{
+		{"defaults", "", listQuery{Page: 1, PerPage: 20}},
+		{"scalars", "page=3&per_page=50&active=true&min=1.5", listQuery{Page: 3, PerPage: 50, Active: true, Min: &min}},
+		{"slices", "tag=a,b&tag=c&id=1&id=2", listQuery{Page: 1, PerPage: 20, Tags: []string{"a", "b", "c"}, IDs: []int{1, 2}}},
+		{"modifiers", "sort=%20Name%20", listQuery{Page: 1, PerPage: 20, Sort: "name"}},
+		{"nested", "address.city=Berlin", listQuery{Page: 1, PerPage: 20, Address: struct {
+			City string `query:"city"`
+		}{"Berlin"}}},
+		{"times", "since=2024-01-02&timeout=30s", listQuery{Page: 1, PerPage: 20, Since: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Timeout: 30 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestContext(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			var got listQuery
+			if err := c.BindQuery(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindQueryConversionError(t *testing.T) {
+	c := newTestContext(httptest.NewRequest(http.MethodGet, "/?page=two", nil))
+	var got listQuery
+	err := c.BindQuery(&got)
+	if err == nil || err.Status() != http.StatusBadRequest || err.Error() != "failed to convert parameter page to int" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestBindSources(t *testing.T) {
+	mux := http.NewServeMux()
+	var got struct {
+		ID      int    `path:"id"`
+		Token   string `header:"x-token"`
+		Session string `cookie:"session"`
+		Name    string `json:"name" validate:"required"`
+	}
+	mux.Handle("POST /users/{id}", Handler(func(c *Context) error {
+		if err := c.Bind(&got); err != nil {
+			return err
+		}
+		return nil
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`{"name":"Ada"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Token", "secret")
+	r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got.ID != 42 || got.Token != "secret" || got.Session != "s1" || got.Name != "Ada" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestBindInvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{"default", &struct {
+			Page int `query:"page" default:"one"`
+		}{}},
+		{"modifier", &struct {
+			Name string `query:"name" mod:"trim,bogus"`
+		}{}},
+		{"modifier of an unset field", &struct {
+			Filter *struct {
+				Name string `query:"name" mod:"bogus"`
+			} `query:"filter"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestContext(httptest.NewRequest(http.MethodGet, "/?name=a", nil))
+			err := c.Bind(tt.data)
+			if err == nil || err.Status() != http.StatusInternalServerError {
+				t.Fatalf("got %v, want 500", err)
+			}
+		})
+	}
+}
+
+func TestBindFormBody(t *testing.T) {
+	form := url.Values{"name": {"Ada"}, "age": {"36"}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var got struct {
+		Name string `form:"name"`
+		Age  int    `form:"age"`
+	}
+	if err := newTestContext(r).Bind(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "Ada" || got.Age != 36 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestBindValidationFields(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"items":[{"price":0}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	var got struct {
+		Email string `json:"email" validate:"required"`
+		Items []struct {
+			Price int `json:"price" validate:"gt=0"`
+		} `json:"items" validate:"dive"`
+	}
+	err := newTestContext(r).Bind(&got)
+	if err == nil {
+		t.Fatal("want a validation error")
+	}
+	var fields []string
+	for _, f := range err.Fields() {
+		fields = append(fields, f.Field+":"+f.Rule)
+	}
+	if want := []string{"email:required", "items[0].price:gt"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("got fields %v, want %v", fields, want)
+	}
+	details := map[string]interface{}{
+		"email":          []string{"email is a required field"},
+		"items[0].price": []string{"price must be greater than 0"},
+	}
+	if !reflect.DeepEqual(err.Details(), details) {
+		t.Errorf("got details %v, want %v", err.Details(), details)
+	}
+}
+
+func BenchmarkBindQuery(b *testing.B) {
+	query := url.Values{
+		"page": {"3"}, "per_page": {"50"}, "sort": {"name"}, "tag": {"a,b", "c"},
+		"id": {"1", "2"}, "min": {"1.5"}, "active": {"true"}, "address.city": {"Berlin"},
+	}
+	r := httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil)
+
+	b.Run("cached", func(b *testing.B) {
+		c := newTestContext(r)
+		b.ReportAllocs()
+		for b.Loop() {
+			var q listQuery
+			if err := c.BindQuery(&q); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		c := newTestContext(r)
+		b.ReportAllocs()
+		for b.Loop() {
+			fieldCache.Clear()
+			var q listQuery
+			if err := c.BindQuery(&q); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestBindNonStruct(t *testing.T) {
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/?id=3", strings.NewReader(`[1,2]`))
+		r.Header.Set("Content-Type", "application/json")
+		return r
+	}
+	var all []int
+	if err := newTestContext(newRequest()).Bind(&all); err != nil || !reflect.DeepEqual(all, []int{1, 2}) {
+		t.Errorf("Bind: got %v, %v", all, err)
+	}
+	var body []int
+	if err := newTestContext(newRequest()).BindBody(&body); err != nil || !reflect.DeepEqual(body, []int{1, 2}) {
+		t.Errorf("BindBody: got %v, %v", body, err)
+	}
+	var query []int
+	if err := newTestContext(newRequest()).BindQuery(&query); err != nil || query != nil {
+		t.Errorf("BindQuery: got %v, %v", query, err)
+	}
+	var headers map[string]string
+	if err := newTestContext(newRequest()).BindHeaders(&headers); err != nil || headers != nil {
+		t.Errorf("BindHeaders: got %v, %v", headers, err)
+	}
+}